@@ -49,6 +49,7 @@ type TypeDef struct {
 	Token Token.Token // The 'typedef' token
 	Name  *Identifier
 	Pairs map[string]Expression
+	Keys  []string // The keys of Pairs in the order they were written
 }
 
 type VarStatement struct {
@@ -150,6 +151,7 @@ type ArrayLiteral struct {
 type HashLiteral struct {
 	Token Token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // The keys of Pairs in the order they were written
 }
 
 type IndexExpression struct {
@@ -0,0 +1,94 @@
+package Ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Writes the syntax tree under node to out, one node per line and children indented under their parent
+func Dump(out io.Writer, node Node) {
+	if program, ok := node.(*Program); ok {
+		for _, stmt := range program.Statements {
+			dumpNode(out, reflect.ValueOf(stmt), "", 0)
+		}
+		return
+	}
+
+	dumpNode(out, reflect.ValueOf(node), "", 0)
+}
+
+/*
+Prints a syntax tree node and its children indented, one per line. Nodes are walked through reflection so
+every node type is covered, tokens are left out since they only repeat what the node says.
+*/
+func dumpNode(out io.Writer, v reflect.Value, label string, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil() {
+		fmt.Fprintf(out, "%s%snil\n", indent, label)
+		return
+	}
+
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fmt.Fprintf(out, "%s%s%s\n", indent, label, v.Type().Name())
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+
+			if !field.IsExported() || field.Name == "Token" || field.Name == "Keys" {
+				continue
+			}
+
+			// Hash literal pairs are shown in the order they were written
+			if keys := v.FieldByName("Keys"); field.Name == "Pairs" && keys.IsValid() {
+				fmt.Fprintf(out, "%s  Pairs:\n", indent)
+
+				for k := 0; k < keys.Len(); k++ {
+					key := keys.Index(k)
+					dumpNode(out, key, "key: ", depth+2)
+					dumpNode(out, v.Field(i).MapIndex(key), "value: ", depth+3)
+				}
+				continue
+			}
+
+			dumpNode(out, v.Field(i), field.Name+": ", depth+1)
+		}
+
+	case reflect.Slice:
+		if v.Len() == 0 {
+			fmt.Fprintf(out, "%s%s[]\n", indent, label)
+			return
+		}
+
+		fmt.Fprintf(out, "%s%s\n", indent, label)
+		for i := 0; i < v.Len(); i++ {
+			dumpNode(out, v.Index(i), fmt.Sprintf("[%d] ", i), depth+1)
+		}
+
+	case reflect.Map:
+		fmt.Fprintf(out, "%s%s\n", indent, label)
+
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface()) })
+
+		for _, key := range keys {
+			dumpNode(out, key, "key: ", depth+1)
+			dumpNode(out, v.MapIndex(key), "value: ", depth+2)
+		}
+
+	default:
+		fmt.Fprintf(out, "%s%s%#v\n", indent, label, v.Interface())
+	}
+}
@@ -62,6 +62,12 @@ const (
 	OpGetBuiltin
 	OpClosure
 	OpCurrentClosure
+
+	// Native modules, the operand is the constant holding the module's name
+	OpLoadModule
+
+	// x in collection, pops the collection and x and pushes whether x is in it
+	OpIn
 )
 
 /*
@@ -111,6 +117,8 @@ var defs = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpLoadModule:     {"OpLoadModule", []int{2}},
+	OpIn:             {"OpIn", []int{}},
 }
 
 func LookupOp(op byte) (*Definition, error) {
@@ -185,10 +193,11 @@ func (ins Instructions) MiniDisassembler() string {
 	var out bytes.Buffer
 
 	i := 0
-	for i <= len(ins) {
+	for i < len(ins) {
 		def, err := LookupOp(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "Error: %s\n", err)
+			i++
 			continue
 		}
 		operands, read := ReadOperands(def, ins[i+1:])
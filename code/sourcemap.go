@@ -0,0 +1,37 @@
+package code
+
+import "sort"
+
+// Where in the source code the instructions starting at Offset came from
+type SourcePos struct {
+	Offset   int
+	Filename string
+	Line     int
+	Column   int
+}
+
+/*
+A SourceMap maps instruction offsets back to source lines. There is only an entry when the line
+changes, so the position of an instruction is the one of the last entry at or before its offset.
+Entries are always sorted by Offset since the compiler only ever appends instructions.
+*/
+type SourceMap []SourcePos
+
+// Returns the index of the entry covering the instruction at offset, or -1 if there is none
+func (sm SourceMap) Index(offset int) int {
+	i := sort.Search(len(sm), func(i int) bool {
+		return sm[i].Offset > offset
+	})
+
+	return i - 1
+}
+
+func (sm SourceMap) Lookup(offset int) (SourcePos, bool) {
+	i := sm.Index(offset)
+
+	if i < 0 {
+		return SourcePos{}, false
+	}
+
+	return sm[i], true
+}
@@ -0,0 +1,56 @@
+package compiler
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	object "github/FabioVV/comp_lang/object"
+	"io"
+)
+
+// Compiled programs written by momo build start with this, followed by the format version
+const BYTECODEMAGIC string = "momo-bytecode"
+
+/*
+Bumped whenever the opcodes, the builtins or the encoding change, old files have to be rebuilt then.
+Compiled code refers to opcodes and builtins by their index, so adding one at the end counts too.
+TestBytecodeLayout pins both tables to this version and fails until they agree again
+*/
+const BYTECODEVERSION int = 2
+
+// The file extension momo build uses
+const BYTECODESUFFIX string = ".momoc"
+
+// The only objects the compiler puts in the constant pool
+func init() {
+	gob.Register(&object.Integer{})
+	gob.Register(&object.Float{})
+	gob.Register(&object.String{})
+	gob.Register(&object.CompiledFunction{})
+}
+
+type bytecodeFile struct {
+	Magic    string
+	Version  int
+	Bytecode *Bytecode
+}
+
+// Writes the bytecode in the format momo build produces and momo run can load
+func (b *Bytecode) Encode(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(&bytecodeFile{Magic: BYTECODEMAGIC, Version: BYTECODEVERSION, Bytecode: b})
+}
+
+// Reads bytecode written by Encode
+func DecodeBytecode(r io.Reader) (*Bytecode, error) {
+	file := &bytecodeFile{}
+
+	if err := gob.NewDecoder(r).Decode(file); err != nil || file.Magic != BYTECODEMAGIC {
+		return nil, errors.New("not a compiled momo program")
+	}
+
+	if file.Version != BYTECODEVERSION {
+		return nil, fmt.Errorf("compiled with bytecode version %d, this momo runs version %d, rebuild it", file.Version, BYTECODEVERSION)
+	}
+
+	return file.Bytecode, nil
+}
@@ -6,12 +6,12 @@ import (
 	code "github/FabioVV/comp_lang/code"
 	object "github/FabioVV/comp_lang/object"
 	Token "github/FabioVV/comp_lang/token"
-	"sort"
 )
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
 }
 
 type EmittedInstruction struct {
@@ -23,6 +23,7 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
 }
 
 type Compiler struct {
@@ -32,6 +33,11 @@ type Compiler struct {
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	position code.SourcePos // Source position of the statement being compiled
+
+	loaded   map[string]bool // Files already pulled in by #load
+	warnings []*object.Warning
 }
 
 func (c *Compiler) newCompilerError(format string, token Token.Token, a ...interface{}) *object.Error {
@@ -76,6 +82,7 @@ func New() *Compiler {
 		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		loaded:      make(map[string]bool),
 	}
 }
 
@@ -97,6 +104,14 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 		}
 
 	case *ast.ExpressionStatement:
+		switch node.Expression.(type) {
+		case *ast.Comment, *ast.MultiLineComment:
+			// Comments don't leave anything on the stack, so there is nothing to pop either
+			return nil
+		}
+
+		defer c.restorePosition(c.markPosition(node.Token))
+
 		err := c.Compile(node.Expression)
 		if err != nil {
 			return err
@@ -104,6 +119,14 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 		c.emitInstruction(code.OpPop)
 
 	case *ast.InfixExpression:
+		if node.Token.Type == Token.PERIOD {
+			return c.compileMemberAccess(node)
+		}
+
+		if node.Token.Type == Token.PIPE {
+			return c.compilePipe(node)
+		}
+
 		if node.Operator == "<" {
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -143,6 +166,8 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 			c.emitInstruction(code.OpEqual)
 		case "!=":
 			c.emitInstruction(code.OpNotEqual)
+		case "in":
+			c.emitInstruction(code.OpIn)
 		default:
 			return c.newCompilerError("unknown operator %s", node.Token, node.TokenLiteral())
 
@@ -228,6 +253,7 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 		}
 
 	case *ast.VarStatement:
+		defer c.restorePosition(c.markPosition(node.Token))
 
 		symbol := c.symbolTable.Define(node.Name.Value)
 
@@ -265,15 +291,8 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 		c.emitInstruction(code.OpArray, len(node.Elements))
 
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
+		// Keys are compiled in the order they were written, that's the order the hash keeps them in
+		for _, k := range node.Keys {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -324,6 +343,7 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
@@ -334,12 +354,40 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
 		c.emitInstruction(code.OpClosure, fnIndex, len(freeSymbols))
 
+	case *ast.FunctionStatement:
+		defer c.restorePosition(c.markPosition(node.Token))
+
+		// fn name(a, b) { ... } is the same as var name = fn(a, b) { ... }
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		fn := &ast.FunctionLiteral{
+			Token:      node.Token,
+			Name:       node.Name.Value,
+			Parameters: node.Parameters,
+			Body:       node.Body,
+		}
+
+		err := c.Compile(fn)
+		if err != nil {
+			return err
+		}
+
+		if symbol.Scope == GLOBALSCOPE {
+			c.emitInstruction(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emitInstruction(code.OpSetLocal, symbol.Index)
+		}
+
 	case *ast.ReturnStatement:
+		defer c.restorePosition(c.markPosition(node.Token))
+
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
@@ -362,6 +410,9 @@ func (c *Compiler) Compile(node ast.Node) *object.Error {
 
 		c.emitInstruction(code.OpCall, len(node.Arguments))
 
+	case *ast.LoadExpression:
+		return c.compileLoad(node)
+
 	}
 
 	return nil
@@ -371,7 +422,100 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+	}
+}
+
+// Non fatal problems found while compiling, like a file being #load'ed twice
+func (c *Compiler) Warnings() []*object.Warning {
+	return c.warnings
+}
+
+// Marks the instructions emitted from now on as coming from tok's line and returns the position
+// that was current before, so it can be restored once the statement is compiled
+func (c *Compiler) markPosition(tok Token.Token) code.SourcePos {
+	previous := c.position
+
+	if tok.Pos.Line > 0 {
+		c.position = code.SourcePos{Filename: tok.Filename, Line: tok.Pos.Line, Column: tok.Pos.Column}
+	}
+
+	return previous
+}
+
+func (c *Compiler) restorePosition(pos code.SourcePos) {
+	c.position = pos
+}
+
+// Adds a source map entry for an instruction at pos, unless it belongs to the same line as the one before it
+func (c *Compiler) recordPosition(pos int) {
+	if c.position.Line == 0 {
+		return
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+
+	if n := len(scope.sourceMap); n > 0 {
+		last := scope.sourceMap[n-1]
+
+		if last.Filename == c.position.Filename && last.Line == c.position.Line {
+			return
+		}
+	}
+
+	entry := c.position
+	entry.Offset = pos
+
+	scope.sourceMap = append(scope.sourceMap, entry)
+}
+
+// a.b reads the member b of a, which is the same as indexing a with the string "b"
+func (c *Compiler) compileMemberAccess(node *ast.InfixExpression) *object.Error {
+	member, ok := node.Right.(*ast.Identifier)
+	if !ok {
+		return c.newCompilerError("expected a name after '.', got %s", node.Token, node.Right.String())
+	}
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	c.emitInstruction(code.OpConstant, c.addConstant(&object.String{Value: member.Value}))
+	c.emitInstruction(code.OpIndex)
+
+	return nil
+}
+
+/*
+x | f calls f with x, x | f(a, b) calls f with x before the other arguments, so x | f | g(2) is g(f(x), 2).
+It compiles to the same instructions the call written out would.
+*/
+func (c *Compiler) compilePipe(node *ast.InfixExpression) *object.Error {
+	function := node.Right
+	arguments := []ast.Expression{}
+
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		function = call.Function
+		arguments = call.Arguments
+	}
+
+	if err := c.Compile(function); err != nil {
+		return err
+	}
+
+	if err := c.Compile(node.Left); err != nil {
+		return err
 	}
+
+	for _, a := range arguments {
+		if err := c.Compile(a); err != nil {
+			return err
+		}
+	}
+
+	c.emitInstruction(code.OpCall, len(arguments)+1)
+
+	return nil
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -383,6 +527,7 @@ func (c *Compiler) emitInstruction(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
+	c.recordPosition(pos)
 	c.setLastInstruction(op, pos)
 
 	return pos
@@ -422,6 +567,13 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// Drop source map entries that pointed at the removed instruction
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= last.Position {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -0,0 +1,106 @@
+package compiler
+
+import (
+	ast "github/FabioVV/comp_lang/ast"
+	code "github/FabioVV/comp_lang/code"
+	lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/lib"
+	object "github/FabioVV/comp_lang/object"
+	parser "github/FabioVV/comp_lang/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+#load "file.momo" pulls the statements of another momo file into the program being compiled, right where
+the #load is. Relative paths are resolved from the directory of the file doing the #load.
+Like every other expression it leaves a value on the stack (null), the expression statement pops it.
+*/
+func (c *Compiler) compileLoad(node *ast.LoadExpression) *object.Error {
+	file, ok := node.File.(*ast.StringLiteral)
+
+	if !ok {
+		return c.newCompilerError("Path to #load must be a string (path of file) : %s", node.Token, node.File)
+	}
+
+	if !strings.HasSuffix(file.Value, ".momo") {
+		return c.compileModuleLoad(node, file.Value)
+	}
+
+	path := ResolveLoadPath(node.Token.Filename, file.Value)
+
+	if c.loaded[path] {
+		w := object.NewWarning("%s has already been loaded once, skipping load", node.Token, file.Value)
+		c.warnings = append(c.warnings, w)
+
+		c.emitInstruction(code.OpNull)
+		return nil
+	}
+
+	src, err := os.Open(path)
+
+	if err != nil {
+		if os.IsPermission(err) {
+			return c.newCompilerError("Permission denied trying to open file : %s", node.Token, file.Value)
+		}
+
+		return c.newCompilerError("File not found : %s", node.Token, file.Value)
+	}
+
+	defer src.Close()
+
+	l := lexer.New(src, path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return p.Errors()[0]
+	}
+
+	c.loaded[path] = true
+
+	for _, s := range program.Statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+
+	c.emitInstruction(code.OpNull)
+
+	return nil
+}
+
+/*
+#load "name" without the .momo binds one of the native modules in lib to a variable with the module's name
+in the current scope, its members are read with module.member.
+*/
+func (c *Compiler) compileModuleLoad(node *ast.LoadExpression, name string) *object.Error {
+	if !lib.Exists(name) {
+		return c.newCompilerError("Unknown library : %s", node.Token, name)
+	}
+
+	// Unlike files a module can be loaded again, a function may want it under its own local name
+	symbol := c.symbolTable.Define(name)
+
+	c.emitInstruction(code.OpLoadModule, c.addConstant(&object.String{Value: name}))
+
+	if symbol.Scope == GLOBALSCOPE {
+		c.emitInstruction(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emitInstruction(code.OpSetLocal, symbol.Index)
+	}
+
+	c.emitInstruction(code.OpNull)
+
+	return nil
+}
+
+// Where #load looks for file when it is used inside the file named from
+func ResolveLoadPath(from string, file string) string {
+	if filepath.IsAbs(file) {
+		return filepath.Clean(file)
+	}
+
+	return filepath.Join(filepath.Dir(from), file)
+}
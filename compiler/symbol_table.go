@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -97,3 +99,16 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 
 	return symbol
 }
+
+// Every symbol defined directly in this table, sorted by name. The REPL lists and completes globals with it
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+
+	return symbols
+}
@@ -0,0 +1,487 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	Ast "github/FabioVV/comp_lang/ast"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	Parser "github/FabioVV/comp_lang/parser"
+	Token "github/FabioVV/comp_lang/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const INDENT = "    "
+
+// The extension momo source files have
+const SOURCESUFFIX = ".momo"
+
+// Literals, identifiers and everything else that never needs parentheses around it
+const PRIMARY = Parser.INDEX + 1
+
+/*
+Format parses src and prints it back in the canonical layout: one statement per line indented with
+INDENT, spaces around binary operators, opening braces on the same line, a semicolon after every
+statement that isn't a block or a comment and at most one blank line between statements.
+Comments stay where they were: a comment written at the end of a line stays at the end of that line,
+any other comment gets a line of its own.
+*/
+func Format(src io.Reader, filename string) ([]byte, error) {
+	l := Lexer.New(src, filename)
+	p := Parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(p.Errors()[0].Inspect())
+	}
+
+	pr := &printer{}
+
+	if l.Shebang != "" {
+		pr.out.WriteString(l.Shebang + "\n")
+	}
+
+	pr.statements(program.Statements, false)
+
+	if pr.err != nil {
+		return nil, pr.err
+	}
+
+	if pr.out.Len() > 0 {
+		pr.out.WriteString("\n")
+	}
+
+	return pr.out.Bytes(), nil
+}
+
+// FormatFile formats the file at path, returning the formatted source and whether it differs from what's on disk
+func FormatFile(path string) ([]byte, bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	formatted, err := Format(bytes.NewReader(src), path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return formatted, !bytes.Equal(src, formatted), nil
+}
+
+// Finds every .momo file under paths. Paths that are files are taken as they are
+func Files(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && strings.HasSuffix(d.Name(), SOURCESUFFIX) {
+				files = append(files, p)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+type printer struct {
+	out   bytes.Buffer
+	depth int
+	err   error
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat(INDENT, p.depth))
+}
+
+func (p *printer) fail(format string, tok Token.Token, a ...interface{}) {
+	if p.err != nil {
+		return
+	}
+
+	if tok.Pos.Line == 0 {
+		p.err = fmt.Errorf(format, a...)
+		return
+	}
+
+	p.err = fmt.Errorf("%s:%d: %s", tok.Filename, tok.Pos.Line, fmt.Sprintf(format, a...))
+}
+
+// The token a statement starts with
+func firstToken(s Ast.Statement) Token.Token {
+	switch s := s.(type) {
+	case *Ast.VarStatement:
+		return s.Token
+	case *Ast.FunctionStatement:
+		return s.Token
+	case *Ast.ReturnStatement:
+		return s.Token
+	case *Ast.BreakStatement:
+		return s.Token
+	case *Ast.ContinueStatement:
+		return s.Token
+	case *Ast.ExpressionStatement:
+		return s.Token
+	case *Ast.BlockStatement:
+		return s.Token
+	}
+
+	return Token.Token{}
+}
+
+func isComment(s Ast.Statement) bool {
+	es, ok := s.(*Ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+
+	switch es.Expression.(type) {
+	case *Ast.Comment, *Ast.MultiLineComment:
+		return true
+	}
+
+	return false
+}
+
+/*
+Prints a list of statements. Inside a block every statement starts on a new line, since the block's
+opening brace was already written, at the top level the first one starts right away.
+A comment that was on the same line as the token before it is kept on that line.
+*/
+func (p *printer) statements(stmts []Ast.Statement, inBlock bool) {
+	for i, s := range stmts {
+		tok := firstToken(s)
+		follows := i > 0 || inBlock
+
+		if follows && isComment(s) && tok.Newlines == 0 {
+			p.write(" ")
+			p.statement(s)
+			continue
+		}
+
+		if follows {
+			if i > 0 && tok.Newlines > 1 {
+				p.write("\n")
+			}
+
+			p.newline()
+		}
+
+		p.statement(s)
+	}
+}
+
+func (p *printer) block(b *Ast.BlockStatement) {
+	if b == nil {
+		p.write("{}")
+		return
+	}
+
+	if len(b.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.depth++
+	p.statements(b.Statements, true)
+	p.depth--
+	p.newline()
+	p.write("}")
+}
+
+func (p *printer) statement(s Ast.Statement) {
+	switch s := s.(type) {
+	case *Ast.VarStatement:
+		p.varStatement(s)
+		p.write(";")
+
+	case *Ast.FunctionStatement:
+		p.write("fn " + s.Name.Value)
+		p.parameters(s.Parameters)
+		p.write(" ")
+		p.block(s.Body)
+
+	case *Ast.ReturnStatement:
+		p.write("return ")
+		p.expression(s.ReturnValue, Parser.LOWEST)
+		p.write(";")
+
+	case *Ast.BreakStatement:
+		p.write("break;")
+
+	case *Ast.ContinueStatement:
+		p.write("continue;")
+
+	case *Ast.BlockStatement:
+		p.block(s)
+
+	case *Ast.ExpressionStatement:
+		switch e := s.Expression.(type) {
+		case *Ast.Comment:
+			p.write("//" + e.Value)
+
+		case *Ast.MultiLineComment:
+			p.write("/*" + e.Value + "*/")
+
+		case *Ast.IFexpression, *Ast.FORexpression, *Ast.LoopExpression, *Ast.TypeDef, *Ast.LoadExpression:
+			p.expression(e, Parser.LOWEST)
+
+		default:
+			p.expression(e, Parser.LOWEST)
+			p.write(";")
+		}
+
+	default:
+		p.fail("can't format %T", firstToken(s), s)
+	}
+}
+
+func (p *printer) varStatement(s *Ast.VarStatement) {
+	p.write("var " + s.Name.Value + " = ")
+	p.expression(s.Value, Parser.LOWEST)
+}
+
+func (p *printer) parameters(params []*Ast.Identifier) {
+	names := []string{}
+
+	for _, param := range params {
+		names = append(names, param.Value)
+	}
+
+	p.write("(" + strings.Join(names, ", ") + ")")
+}
+
+func (p *printer) expressions(list []Ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.write(", ")
+		}
+
+		p.expression(e, Parser.LOWEST)
+	}
+}
+
+// How tightly an expression holds together, it gets parentheses when its parent binds tighter
+func precedence(e Ast.Expression) int {
+	switch e := e.(type) {
+	case *Ast.InfixExpression:
+		return Parser.Precedence(e.Token.Type)
+
+	case *Ast.PrefixExpression:
+		return Parser.PREFIX
+
+	case *Ast.CallExpression:
+		return Parser.CALL
+
+	case *Ast.IndexExpression:
+		return Parser.INDEX
+
+	case *Ast.AssignExpression, *Ast.CompoundAssignExpression, *Ast.AssignIndexExpression, *Ast.TypeDefStatement:
+		return Parser.LOWEST
+	}
+
+	return PRIMARY
+}
+
+// Prints e, wrapped in parentheses if it binds looser than min
+func (p *printer) expression(e Ast.Expression, min int) {
+	if e == nil {
+		p.fail("can't format an incomplete expression", Token.Token{})
+		return
+	}
+
+	if precedence(e) < min {
+		p.write("(")
+		p.expression(e, Parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch e := e.(type) {
+	case *Ast.Identifier:
+		p.write(e.Value)
+
+	case *Ast.IntegerLiteral, *Ast.FloatLiteral, *Ast.Boolean:
+		p.write(e.TokenLiteral())
+
+	case *Ast.StringLiteral:
+		p.write("\"" + e.Value + "\"")
+
+	case *Ast.PrefixExpression:
+		p.write(e.Operator)
+		p.expression(e.Right, Parser.PREFIX+1)
+
+	case *Ast.InfixExpression:
+		prec := Parser.Precedence(e.Token.Type)
+
+		p.expression(e.Left, prec)
+
+		if e.Token.Type == Token.PERIOD {
+			p.write(e.Operator)
+		} else {
+			p.write(" " + e.Operator + " ")
+		}
+
+		// Operators are left associative, so a right operand of the same precedence needs parentheses
+		p.expression(e.Right, prec+1)
+
+	case *Ast.IncDecExpression:
+		p.write(e.Identifier.Value + e.Token.Literal)
+
+	case *Ast.AssignExpression:
+		p.write(e.Left.Value + " = ")
+		p.expression(e.Value, Parser.LOWEST)
+
+	case *Ast.CompoundAssignExpression:
+		p.write(e.Left.Value + " " + e.Token.Literal + " ")
+		p.expression(e.Value, Parser.LOWEST)
+
+	case *Ast.AssignIndexExpression:
+		p.expression(e.Left, Parser.INDEX)
+		p.write("[")
+		p.expression(e.Index, Parser.LOWEST)
+		p.write("] = ")
+		p.expression(e.Value, Parser.LOWEST)
+
+	case *Ast.IndexExpression:
+		p.expression(e.Left, Parser.INDEX)
+		p.write("[")
+		p.expression(e.Index, Parser.LOWEST)
+		p.write("]")
+
+	case *Ast.CallExpression:
+		p.expression(e.Function, Parser.CALL)
+		p.write("(")
+		p.expressions(e.Arguments)
+		p.write(")")
+
+	case *Ast.ArrayLiteral:
+		p.write("[")
+		p.expressions(e.Elements)
+		p.write("]")
+
+	case *Ast.HashLiteral:
+		p.write("{")
+
+		for i, key := range e.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+
+			p.expression(key, Parser.LOWEST)
+			p.write(": ")
+			p.expression(e.Pairs[key], Parser.LOWEST)
+		}
+
+		p.write("}")
+
+	case *Ast.FunctionLiteral:
+		p.write("fn")
+		p.parameters(e.Parameters)
+		p.write(" ")
+		p.block(e.Body)
+
+	case *Ast.IFexpression:
+		p.write("if (")
+		p.expression(e.Condition, Parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *Ast.FORexpression:
+		p.write("for (")
+
+		if e.LoopVariable != nil {
+			p.varStatement(e.LoopVariable)
+		}
+
+		p.write("; ")
+		p.expression(e.LoopCondition, Parser.LOWEST)
+		p.write("; ")
+		p.expression(e.LoopStep, Parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+
+	case *Ast.LoopExpression:
+		p.write("loop ")
+		p.block(e.Body)
+
+	case *Ast.TypeDef:
+		p.write("typedef " + e.Name.Value + " ")
+
+		if len(e.Keys) == 0 {
+			p.write("{}")
+			return
+		}
+
+		p.write("{")
+		p.depth++
+
+		for i, key := range e.Keys {
+			p.newline()
+			p.write(key + ": ")
+			p.expression(e.Pairs[key], Parser.LOWEST)
+
+			if i < len(e.Keys)-1 {
+				p.write(",")
+			}
+		}
+
+		p.depth--
+		p.newline()
+		p.write("}")
+
+	case *Ast.TypeDefStatement:
+		p.write(e.Token.Literal + " " + e.Name.Value + " = ")
+		p.expression(e.Value, Parser.LOWEST)
+
+	case *Ast.LoadExpression:
+		p.write("#load ")
+		p.expression(e.File, Parser.LOWEST)
+
+	case *Ast.Comment:
+		p.fail("comments are only supported between statements", e.Token)
+
+	case *Ast.MultiLineComment:
+		p.fail("comments are only supported between statements", e.Token)
+
+	default:
+		p.fail("can't format %T", Token.Token{}, e)
+	}
+}
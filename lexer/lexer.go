@@ -16,11 +16,16 @@ type Lexer struct {
 	Input    *bufio.Reader
 	Pos      Token.Position
 	errors   []*Object.Error
+	lastLine int // Line where the last token read ended
+	started  bool
+
+	// The #! line the input started with, without its line break. Empty if there was none
+	Shebang string
 }
 
 // Creates our lexer. Initializes the line and column position at 1, our input as a *bufio.Reader and filename
 func New(reader io.Reader, Filename string) *Lexer {
-	return &Lexer{Input: bufio.NewReader(reader), Pos: Token.Position{Line: 1, Column: 1}, Filename: Filename}
+	return &Lexer{Input: bufio.NewReader(reader), Pos: Token.Position{Line: 1, Column: 1}, Filename: Filename, lastLine: 1}
 }
 
 func newLexerError(format string, pos Token.Position, filename string, a ...interface{}) *Object.Error {
@@ -81,7 +86,8 @@ func (l *Lexer) ReadIdentifier() (string, *Object.Error) {
 
 		l.Pos.Column++
 
-		if unicode.IsLetter(r) || r == '_' {
+		// Digits can follow the first character, like in log10
+		if unicode.IsLetter(r) || r == '_' || literal.Len() > 0 && unicode.IsDigit(r) {
 			literal.WriteRune(r)
 
 		} else {
@@ -154,6 +160,8 @@ func (l *Lexer) readMultiLineComment() (string, *Object.Error) {
 			if peekChar == '/' {
 				return str.String(), nil
 			} else {
+				// A * that doesn't close the comment is part of it
+				str.WriteRune(r)
 				l.Backup()
 			}
 
@@ -287,11 +295,54 @@ func newToken(tokenType Token.TokenType, Filename string, Line int, Column int,
 	return Token.Token{Type: tokenType, Pos: Token.Position{Line: Line, Column: Column}, Filename: Filename, Literal: string(ch)}
 }
 
+/*
+NextToken reads the next token and records how many line breaks came before it.
+The formatter uses that to keep blank lines and to tell a comment at the end of a line from one on its own line
+*/
 func (l *Lexer) NextToken() (Token.Position, Token.Token) {
-	var tok Token.Token
+	if !l.started {
+		l.started = true
+		l.skipShebang()
+	}
 
 	l.skipWhitespace()
 
+	startLine := l.Pos.Line
+	pos, tok := l.nextToken()
+
+	tok.Newlines = startLine - l.lastLine
+
+	// A single line comment consumes the line break that ends it
+	if tok.Type == Token.COMMENT {
+		l.lastLine = startLine
+	} else {
+		l.lastLine = l.Pos.Line
+	}
+
+	return pos, tok
+}
+
+// A #! line is only a shebang when it's the very first thing in the input, so scripts can be run directly
+func (l *Lexer) skipShebang() {
+	if start, err := l.Input.Peek(2); err != nil || string(start) != "#!" {
+		return
+	}
+
+	line, _ := l.Input.ReadString('\n')
+
+	l.Shebang = strings.TrimRight(line, "\r\n")
+
+	if strings.HasSuffix(line, "\n") {
+		l.Pos.Line++
+		l.Pos.Column = 1
+	}
+
+	l.lastLine = l.Pos.Line
+}
+
+func (l *Lexer) nextToken() (Token.Position, Token.Token) {
+	var tok Token.Token
+
 	for {
 
 		r, _, err := l.Input.ReadRune()
@@ -378,9 +429,12 @@ func (l *Lexer) NextToken() (Token.Position, Token.Token) {
 				break
 			}
 
+			// Comments are positioned where they start, reading them moves l.Pos past their end
+			start := Token.Position{Line: l.Pos.Line, Column: l.Pos.Column}
+
 			if peekChar == '/' {
 				literal, _ := l.readComment()
-				tok = Token.Token{Type: Token.COMMENT, Pos: Token.Position{Line: l.Pos.Line, Column: l.Pos.Column}, Filename: l.Filename, Literal: literal}
+				tok = Token.Token{Type: Token.COMMENT, Pos: start, Filename: l.Filename, Literal: literal}
 
 			} else if peekChar == '*' {
 				literal, err := l.readMultiLineComment()
@@ -390,7 +444,7 @@ func (l *Lexer) NextToken() (Token.Position, Token.Token) {
 					break
 				}
 
-				tok = Token.Token{Type: Token.MULTILINE_COMMENT, Pos: Token.Position{Line: l.Pos.Line, Column: l.Pos.Column}, Filename: l.Filename, Literal: literal}
+				tok = Token.Token{Type: Token.MULTILINE_COMMENT, Pos: start, Filename: l.Filename, Literal: literal}
 
 			} else if peekChar == '=' {
 				literal := string(r) + string(peekChar)
@@ -570,7 +624,7 @@ func (l *Lexer) NextToken() (Token.Position, Token.Token) {
 			}
 
 		case '"':
-			tok.Type = Token.STRING
+			tok = Token.Token{Type: Token.STRING, Pos: Token.Position{Line: l.Pos.Line, Column: l.Pos.Column}, Filename: l.Filename}
 			tok.Literal, _ = l.readString()
 
 		case 0:
@@ -582,7 +636,7 @@ func (l *Lexer) NextToken() (Token.Position, Token.Token) {
 			l.Pos.Column = 0
 
 		default:
-			if unicode.IsLetter(r) {
+			if unicode.IsLetter(r) || r == '_' {
 
 				l.Backup()
 
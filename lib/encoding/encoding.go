@@ -0,0 +1,340 @@
+package encoding
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	Object "github/FabioVV/comp_lang/object"
+	"hash"
+	"hash/crc32"
+	"net/url"
+	"sort"
+)
+
+/*
+The encoding module, encodings and checksums. Data is either a string or an array of bytes, integers
+from 0 to 255, bytes(s) and from_bytes(array) go between the two. Decoding gives strings, which may hold
+any bytes, and digests are written in hex, hex_decode gives the raw digest back.
+*/
+var Encoding = map[string]Object.Object{
+	"bytes":      &Object.Builtin{Fn: toBytes},
+	"from_bytes": &Object.Builtin{Fn: fromBytes},
+
+	"base64_encode":    &Object.Builtin{Fn: encoder("base64_encode", base64.StdEncoding.EncodeToString)},
+	"base64_decode":    &Object.Builtin{Fn: decoder("base64_decode", base64.StdEncoding.DecodeString)},
+	"base64url_encode": &Object.Builtin{Fn: encoder("base64url_encode", base64.URLEncoding.EncodeToString)},
+	"base64url_decode": &Object.Builtin{Fn: decoder("base64url_decode", base64.URLEncoding.DecodeString)},
+	"hex_encode":       &Object.Builtin{Fn: encoder("hex_encode", hex.EncodeToString)},
+	"hex_decode":       &Object.Builtin{Fn: decoder("hex_decode", hex.DecodeString)},
+
+	"md5":    &Object.Builtin{Fn: digest("md5")},
+	"sha1":   &Object.Builtin{Fn: digest("sha1")},
+	"sha256": &Object.Builtin{Fn: digest("sha256")},
+	"sha512": &Object.Builtin{Fn: digest("sha512")},
+	"hmac":   &Object.Builtin{Fn: hmacDigest},
+	"crc32":  &Object.Builtin{Fn: checksum},
+
+	"url_escape":       &Object.Builtin{Fn: urlEscape},
+	"url_unescape":     &Object.Builtin{Fn: urlUnescape},
+	"query_encode":     &Object.Builtin{Fn: queryEncode},
+	"query_decode":     &Object.Builtin{Fn: queryDecode},
+	"query_decode_all": &Object.Builtin{Fn: queryDecodeAll},
+}
+
+// The hash functions digest and hmac know by name
+var algorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+// The bytes of a string or of an array of byte values
+func data(name string, arg Object.Object) ([]byte, *Object.Error) {
+	switch arg := arg.(type) {
+	case *Object.String:
+		return []byte(arg.Value), nil
+
+	case *Object.Array:
+		out := make([]byte, len(arg.Elements))
+
+		for i, el := range arg.Elements {
+			b, ok := el.(*Object.Integer)
+			if !ok || b.Value < 0 || b.Value > 255 {
+				return nil, Object.NewBuiltinError("'%s' needs an array of bytes from 0 to 255, element %d is %s", name, i, el.Inspect())
+			}
+			out[i] = byte(b.Value)
+		}
+
+		return out, nil
+	}
+
+	return nil, Object.NewBuiltinError("argument to '%s' must be STRING or an ARRAY of bytes, got %s", name, arg.Type())
+}
+
+// The data a function taking only data was called with
+func oneData(name string, args []Object.Object) ([]byte, *Object.Error) {
+	if len(args) != 1 {
+		return nil, wrongArgs(name, len(args), "1")
+	}
+
+	return data(name, args[0])
+}
+
+// bytes(data) is the array of the bytes of data
+func toBytes(args ...Object.Object) Object.Object {
+	b, err := oneData("bytes", args)
+	if err != nil {
+		return err
+	}
+
+	elements := make([]Object.Object, len(b))
+	for i, value := range b {
+		elements[i] = &Object.Integer{Value: int64(value)}
+	}
+
+	return &Object.Array{Elements: elements}
+}
+
+// from_bytes(data) is the string holding data's bytes
+func fromBytes(args ...Object.Object) Object.Object {
+	b, err := oneData("from_bytes", args)
+	if err != nil {
+		return err
+	}
+
+	return &Object.String{Value: string(b)}
+}
+
+func encoder(name string, fn func([]byte) string) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		b, err := oneData(name, args)
+		if err != nil {
+			return err
+		}
+
+		return &Object.String{Value: fn(b)}
+	}
+}
+
+func decoder(name string, fn func(string) ([]byte, error)) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 1 {
+			return wrongArgs(name, len(args), "1")
+		}
+
+		s, err := str(name, args[0])
+		if err != nil {
+			return err
+		}
+
+		b, decodeErr := fn(s)
+		if decodeErr != nil {
+			return Object.NewBuiltinError("%s: %s", name, decodeErr)
+		}
+
+		return &Object.String{Value: string(b)}
+	}
+}
+
+// md5(data), sha1(data), sha256(data) and sha512(data) are data's digest in hex
+func digest(name string) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		b, err := oneData(name, args)
+		if err != nil {
+			return err
+		}
+
+		h := algorithms[name]()
+		h.Write(b)
+
+		return &Object.String{Value: hex.EncodeToString(h.Sum(nil))}
+	}
+}
+
+// hmac(algorithm, key, data) is data's HMAC in hex, algorithm being "md5", "sha1", "sha256" or "sha512"
+func hmacDigest(args ...Object.Object) Object.Object {
+	if len(args) != 3 {
+		return wrongArgs("hmac", len(args), "3")
+	}
+
+	algorithm, err := str("hmac", args[0])
+	if err != nil {
+		return err
+	}
+
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return Object.NewBuiltinError("unknown 'hmac' algorithm '%s', use md5, sha1, sha256 or sha512", algorithm)
+	}
+
+	key, err := data("hmac", args[1])
+	if err != nil {
+		return err
+	}
+
+	b, err := data("hmac", args[2])
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(newHash, key)
+	mac.Write(b)
+
+	return &Object.String{Value: hex.EncodeToString(mac.Sum(nil))}
+}
+
+// crc32(data) is data's IEEE CRC-32 checksum as an integer
+func checksum(args ...Object.Object) Object.Object {
+	b, err := oneData("crc32", args)
+	if err != nil {
+		return err
+	}
+
+	return &Object.Integer{Value: int64(crc32.ChecksumIEEE(b))}
+}
+
+// url_escape(s) makes s safe to put in a query string, url_unescape(s) undoes it
+func urlEscape(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("url_escape", len(args), "1")
+	}
+
+	s, err := str("url_escape", args[0])
+	if err != nil {
+		return err
+	}
+
+	return &Object.String{Value: url.QueryEscape(s)}
+}
+
+func urlUnescape(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("url_unescape", len(args), "1")
+	}
+
+	s, err := str("url_unescape", args[0])
+	if err != nil {
+		return err
+	}
+
+	unescaped, unescapeErr := url.QueryUnescape(s)
+	if unescapeErr != nil {
+		return Object.NewBuiltinError("url_unescape: %s", unescapeErr)
+	}
+
+	return &Object.String{Value: unescaped}
+}
+
+/*
+query_encode(params) writes a hash as a query string, like a=1&b=x+y, sorted by name. Values are strings
+or arrays of strings for names given more than once. Reading one back, query_decode always gives strings,
+the first value of a repeated name like the query of an http request, and query_decode_all always gives
+arrays, so the type of a value never depends on the query.
+*/
+func queryEncode(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("query_encode", len(args), "1")
+	}
+
+	params, ok := args[0].(*Object.Hash)
+	if !ok {
+		return Object.NewBuiltinError("argument to 'query_encode' must be a HASH, got %s", args[0].Type())
+	}
+
+	values := url.Values{}
+
+	for _, pair := range params.Pairs() {
+		name, ok := pair.Key.(*Object.String)
+		if !ok {
+			return Object.NewBuiltinError("'query_encode' names must be STRING, got %s", pair.Key.Type())
+		}
+
+		switch value := pair.Value.(type) {
+		case *Object.String:
+			values.Add(name.Value, value.Value)
+
+		case *Object.Array:
+			for _, el := range value.Elements {
+				s, ok := el.(*Object.String)
+				if !ok {
+					return Object.NewBuiltinError("'query_encode' values must be STRING, got %s in %s", el.Type(), name.Value)
+				}
+				values.Add(name.Value, s.Value)
+			}
+
+		default:
+			return Object.NewBuiltinError("'query_encode' values must be STRING or an ARRAY of them, got %s for %s", pair.Value.Type(), name.Value)
+		}
+	}
+
+	return &Object.String{Value: values.Encode()}
+}
+
+// query_decode(query) reads a query string into a hash of strings, a name given more than once gets its first value
+func queryDecode(args ...Object.Object) Object.Object {
+	return decodeQuery("query_decode", args, func(given []string) Object.Object {
+		return &Object.String{Value: given[0]}
+	})
+}
+
+// query_decode_all(query) reads a query string into a hash of arrays, every value of every name in the order given
+func queryDecodeAll(args ...Object.Object) Object.Object {
+	return decodeQuery("query_decode_all", args, func(given []string) Object.Object {
+		elements := make([]Object.Object, len(given))
+		for i, v := range given {
+			elements[i] = &Object.String{Value: v}
+		}
+
+		return &Object.Array{Elements: elements}
+	})
+}
+
+func decodeQuery(name string, args []Object.Object, value func(given []string) Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs(name, len(args), "1")
+	}
+
+	query, err := str(name, args[0])
+	if err != nil {
+		return err
+	}
+
+	values, parseErr := url.ParseQuery(query)
+	if parseErr != nil {
+		return Object.NewBuiltinError("%s: %s", name, parseErr)
+	}
+
+	names := make([]string, 0, len(values))
+	for n := range values {
+		names = append(names, n)
+	}
+
+	// Go doesn't keep the order the names were written in, they're sorted like query_encode sorts them
+	sort.Strings(names)
+
+	params := Object.NewHash()
+
+	for _, n := range names {
+		params.Set(&Object.String{Value: n}, value(values[n]))
+	}
+
+	return params
+}
@@ -0,0 +1,347 @@
+package fs
+
+import (
+	"bufio"
+	"errors"
+	Object "github/FabioVV/comp_lang/object"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+The fs module, files, directories and paths. Anything the operating system refuses comes back as an error
+value naming the function and what went wrong, so assert_error and friends can deal with it.
+*/
+var Fs = map[string]Object.Object{
+	"read_file":   &Object.Builtin{Fn: readFile},
+	"read_lines":  &Object.Builtin{Fn: readLines},
+	"each_line":   &Object.Builtin{HostFn: eachLine},
+	"write_file":  &Object.Builtin{Fn: writing("write_file", os.O_TRUNC)},
+	"append_file": &Object.Builtin{Fn: writing("append_file", os.O_APPEND)},
+	"exists":      &Object.Builtin{Fn: exists},
+	"list_dir":    &Object.Builtin{Fn: listDir},
+	"mkdir":       &Object.Builtin{Fn: mkdir},
+	"remove":      &Object.Builtin{Fn: remove},
+	"rename":      &Object.Builtin{Fn: rename},
+	"stat":        &Object.Builtin{Fn: stat},
+
+	"join": &Object.Builtin{Fn: join},
+	"base": &Object.Builtin{Fn: path("base", filepath.Base)},
+	"dir":  &Object.Builtin{Fn: path("dir", filepath.Dir)},
+	"ext":  &Object.Builtin{Fn: path("ext", filepath.Ext)},
+	"abs":  &Object.Builtin{Fn: abs},
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+// The path a function taking only a path was called with
+func onePath(name string, args []Object.Object) (string, *Object.Error) {
+	if len(args) != 1 {
+		return "", wrongArgs(name, len(args), "1")
+	}
+
+	return str(name, args[0])
+}
+
+// What the operating system said, err already names the path
+func failed(name string, err error) *Object.Error {
+	return Object.NewBuiltinError("%s: %s", name, err)
+}
+
+func lines(text string) *Object.Array {
+	elements := []Object.Object{}
+
+	if text == "" {
+		return &Object.Array{Elements: elements}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		elements = append(elements, &Object.String{Value: strings.TrimSuffix(line, "\r")})
+	}
+
+	return &Object.Array{Elements: elements}
+}
+
+func readFile(args ...Object.Object) Object.Object {
+	path, err := onePath("read_file", args)
+	if err != nil {
+		return err
+	}
+
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return failed("read_file", readErr)
+	}
+
+	return &Object.String{Value: string(content)}
+}
+
+// read_lines(path) is the file's lines without their line breaks
+func readLines(args ...Object.Object) Object.Object {
+	path, err := onePath("read_lines", args)
+	if err != nil {
+		return err
+	}
+
+	content, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return failed("read_lines", readErr)
+	}
+
+	return lines(string(content))
+}
+
+/*
+each_line(path, fn) calls fn with every line of the file, reading one line at a time so big files don't have
+to fit in memory. fn returning false stops the reading early.
+*/
+func eachLine(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("each_line", len(args), "2")
+	}
+
+	path, err := str("each_line", args[0])
+	if err != nil {
+		return err
+	}
+
+	switch args[1].(type) {
+	case *Object.Closure, *Object.Builtin:
+	default:
+		return Object.NewBuiltinError("argument to 'each_line' must be a function, got %s", args[1].Type())
+	}
+
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		return failed("each_line", openErr)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+
+	for {
+		line, readErr := reader.ReadString('\n')
+
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return failed("each_line", readErr)
+		}
+
+		if line == "" && readErr != nil {
+			return nil
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		result, callErr := host.Call(args[1], &Object.String{Value: line})
+		if callErr != nil {
+			return Object.NewCallbackError("each_line", callErr)
+		}
+
+		if b, ok := result.(*Object.Boolean); ok && !b.Value {
+			return nil
+		}
+
+		if readErr != nil {
+			return nil
+		}
+	}
+}
+
+// write_file(path, text) replaces the file's content, append_file(path, text) adds to it. Both create missing files
+func writing(name string, mode int) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 2 {
+			return wrongArgs(name, len(args), "2")
+		}
+
+		path, err := str(name, args[0])
+		if err != nil {
+			return err
+		}
+
+		text, err := str(name, args[1])
+		if err != nil {
+			return err
+		}
+
+		f, openErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|mode, 0644)
+		if openErr != nil {
+			return failed(name, openErr)
+		}
+
+		_, writeErr := f.WriteString(text)
+		closeErr := f.Close()
+
+		if writeErr != nil {
+			return failed(name, writeErr)
+		}
+
+		if closeErr != nil {
+			return failed(name, closeErr)
+		}
+
+		return nil
+	}
+}
+
+func exists(args ...Object.Object) Object.Object {
+	path, err := onePath("exists", args)
+	if err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(path)
+
+	return &Object.Boolean{Value: statErr == nil}
+}
+
+// list_dir(path) is the names of the entries in the directory, sorted
+func listDir(args ...Object.Object) Object.Object {
+	path, err := onePath("list_dir", args)
+	if err != nil {
+		return err
+	}
+
+	entries, readErr := os.ReadDir(path)
+	if readErr != nil {
+		return failed("list_dir", readErr)
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+
+	sort.Strings(names)
+
+	elements := make([]Object.Object, len(names))
+	for i, name := range names {
+		elements[i] = &Object.String{Value: name}
+	}
+
+	return &Object.Array{Elements: elements}
+}
+
+// mkdir(path) creates the directory and any missing parents, it's fine if it's already there
+func mkdir(args ...Object.Object) Object.Object {
+	path, err := onePath("mkdir", args)
+	if err != nil {
+		return err
+	}
+
+	if mkdirErr := os.MkdirAll(path, 0755); mkdirErr != nil {
+		return failed("mkdir", mkdirErr)
+	}
+
+	return nil
+}
+
+// remove(path) deletes a file or an empty directory
+func remove(args ...Object.Object) Object.Object {
+	path, err := onePath("remove", args)
+	if err != nil {
+		return err
+	}
+
+	if removeErr := os.Remove(path); removeErr != nil {
+		return failed("remove", removeErr)
+	}
+
+	return nil
+}
+
+func rename(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("rename", len(args), "2")
+	}
+
+	from, err := str("rename", args[0])
+	if err != nil {
+		return err
+	}
+
+	to, err := str("rename", args[1])
+	if err != nil {
+		return err
+	}
+
+	if renameErr := os.Rename(from, to); renameErr != nil {
+		return failed("rename", renameErr)
+	}
+
+	return nil
+}
+
+// stat(path) is a hash with the size in bytes, mtime in seconds since the epoch and is_dir
+func stat(args ...Object.Object) Object.Object {
+	path, err := onePath("stat", args)
+	if err != nil {
+		return err
+	}
+
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return failed("stat", statErr)
+	}
+
+	fields := Object.NewHash()
+	fields.Set(&Object.String{Value: "size"}, &Object.Integer{Value: info.Size()})
+	fields.Set(&Object.String{Value: "mtime"}, &Object.Integer{Value: info.ModTime().Unix()})
+	fields.Set(&Object.String{Value: "is_dir"}, &Object.Boolean{Value: info.IsDir()})
+
+	return fields
+}
+
+// join(parts...) joins path parts with the system's separator, cleaning up the result
+func join(args ...Object.Object) Object.Object {
+	parts := make([]string, len(args))
+
+	for i, arg := range args {
+		part, err := str("join", arg)
+		if err != nil {
+			return err
+		}
+		parts[i] = part
+	}
+
+	return &Object.String{Value: filepath.Join(parts...)}
+}
+
+func path(name string, fn func(string) string) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		p, err := onePath(name, args)
+		if err != nil {
+			return err
+		}
+
+		return &Object.String{Value: fn(p)}
+	}
+}
+
+func abs(args ...Object.Object) Object.Object {
+	p, err := onePath("abs", args)
+	if err != nil {
+		return err
+	}
+
+	absolute, absErr := filepath.Abs(p)
+	if absErr != nil {
+		return failed("abs", absErr)
+	}
+
+	return &Object.String{Value: absolute}
+}
@@ -0,0 +1,508 @@
+package http
+
+import (
+	"context"
+	"errors"
+	Object "github/FabioVV/comp_lang/object"
+	"io"
+	"net"
+	gohttp "net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How long serve waits for requests still being handled when it stops, before dropping them
+const SHUTDOWNDELAY = time.Second
+
+/*
+The http module, a client and a small server. Responses are hashes with the status, the headers and the body:
+
+	{"status": 200, "headers": {"content-type": "text/plain"}, "body": "hi"}
+
+Header names are always lower case. Client options are a hash that may have:
+
+	headers a hash of request headers
+	body    the request body, for request
+	timeout milliseconds after which the request is given up on
+
+A status like 404 isn't an error, only not getting a response at all is. Hosts can take the net capability
+away, every function then gives an error instead of touching the network.
+*/
+var Http = map[string]Object.Object{
+	"get":     &Object.Builtin{HostFn: get},
+	"post":    &Object.Builtin{HostFn: post},
+	"request": &Object.Builtin{HostFn: request},
+	"serve":   &Object.Builtin{HostFn: serve},
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+// A hash of names to values, in the order they're given
+func hash(names []string, values ...Object.Object) *Object.Hash {
+	h := Object.NewHash()
+
+	for i, name := range names {
+		h.Set(&Object.String{Value: name}, values[i])
+	}
+
+	return h
+}
+
+// The names of a Go map sorted, so the hashes made from it always come out the same
+func sortedNames(m map[string][]string) []string {
+	names := make([]string, 0, len(m))
+
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func allowed(host Object.Host, name string) *Object.Error {
+	if !host.Allows(Object.CAPABILITYNET) {
+		return Object.NewBuiltinError("%s: using the network isn't allowed here", name)
+	}
+
+	return nil
+}
+
+// Go's headers as a hash of lower case names, values sent more than once are joined with commas
+func headersHash(header gohttp.Header) *Object.Hash {
+	h := Object.NewHash()
+
+	for _, name := range sortedNames(header) {
+		h.Set(&Object.String{Value: strings.ToLower(name)}, &Object.String{Value: strings.Join(header[name], ", ")})
+	}
+
+	return h
+}
+
+// Copies a hash of header names to STRING values into Go's headers
+func setHeaders(name string, arg Object.Object, header gohttp.Header) *Object.Error {
+	h, ok := arg.(*Object.Hash)
+	if !ok {
+		return Object.NewBuiltinError("'%s' headers must be a HASH, got %s", name, arg.Type())
+	}
+
+	for _, pair := range h.Pairs() {
+		k, keyOk := pair.Key.(*Object.String)
+		v, valueOk := pair.Value.(*Object.String)
+
+		if !keyOk || !valueOk {
+			return Object.NewBuiltinError("'%s' headers must map STRING to STRING, got %s: %s", name, pair.Key.Type(), pair.Value.Type())
+		}
+
+		header.Set(k.Value, v.Value)
+	}
+
+	return nil
+}
+
+// What the options hash asked for
+type options struct {
+	headers Object.Object
+	body    *string
+	timeout time.Duration
+}
+
+func parseOptions(name string, arg Object.Object) (*options, *Object.Error) {
+	opts := &options{}
+
+	if arg == nil {
+		return opts, nil
+	}
+
+	h, ok := arg.(*Object.Hash)
+	if !ok {
+		return nil, Object.NewBuiltinError("options to '%s' must be a HASH, got %s", name, arg.Type())
+	}
+
+	for _, pair := range h.Pairs() {
+		key, ok := pair.Key.(*Object.String)
+		if !ok {
+			return nil, Object.NewBuiltinError("'%s' option names must be STRING, got %s", name, pair.Key.Type())
+		}
+
+		switch key.Value {
+		case "headers":
+			opts.headers = pair.Value
+
+		case "body":
+			body, ok := pair.Value.(*Object.String)
+			if !ok {
+				return nil, Object.NewBuiltinError("'%s' option body must be STRING, got %s", name, pair.Value.Type())
+			}
+
+			opts.body = &body.Value
+
+		case "timeout":
+			ms, ok := pair.Value.(*Object.Integer)
+			if !ok || ms.Value <= 0 {
+				return nil, Object.NewBuiltinError("'%s' option timeout must be a positive INTEGER of milliseconds, got %s", name, pair.Value.Inspect())
+			}
+
+			opts.timeout = time.Duration(ms.Value) * time.Millisecond
+
+		default:
+			return nil, Object.NewBuiltinError("unknown option '%s' for '%s'", key.Value, name)
+		}
+	}
+
+	return opts, nil
+}
+
+// Sends a request and waits for the whole response, giving up if the program is cancelled
+func send(host Object.Host, name string, method string, url string, opts *options) Object.Object {
+	if err := allowed(host, name); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	go func() {
+		select {
+		case <-host.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var body io.Reader
+	if opts.body != nil {
+		body = strings.NewReader(*opts.body)
+	}
+
+	req, reqErr := gohttp.NewRequestWithContext(ctx, method, url, body)
+	if reqErr != nil {
+		return Object.NewBuiltinError("%s: %s", name, reqErr)
+	}
+
+	if opts.headers != nil {
+		if err := setHeaders(name, opts.headers, req.Header); err != nil {
+			return err
+		}
+	}
+
+	resp, respErr := gohttp.DefaultClient.Do(req)
+	if respErr != nil {
+		if opts.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Object.NewBuiltinError("%s: %s %s timed out after %s", name, method, url, opts.timeout)
+		}
+
+		return Object.NewBuiltinError("%s: %s", name, respErr)
+	}
+	defer resp.Body.Close()
+
+	content, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return Object.NewBuiltinError("%s: reading the response: %s", name, readErr)
+	}
+
+	return hash([]string{"status", "headers", "body"},
+		&Object.Integer{Value: int64(resp.StatusCode)},
+		headersHash(resp.Header),
+		&Object.String{Value: string(content)},
+	)
+}
+
+// get(url, options) fetches url
+func get(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("get", len(args), "1 or 2")
+	}
+
+	url, err := str("get", args[0])
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseOptions("get", optional(args, 1))
+	if err != nil {
+		return err
+	}
+
+	return send(host, "get", gohttp.MethodGet, url, opts)
+}
+
+// post(url, body, options) sends body to url
+func post(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("post", len(args), "2 or 3")
+	}
+
+	url, err := str("post", args[0])
+	if err != nil {
+		return err
+	}
+
+	body, err := str("post", args[1])
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseOptions("post", optional(args, 2))
+	if err != nil {
+		return err
+	}
+
+	opts.body = &body
+
+	return send(host, "post", gohttp.MethodPost, url, opts)
+}
+
+// request(method, url, options) sends any kind of request, the body being an option
+func request(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("request", len(args), "2 or 3")
+	}
+
+	method, err := str("request", args[0])
+	if err != nil {
+		return err
+	}
+
+	url, err := str("request", args[1])
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseOptions("request", optional(args, 2))
+	if err != nil {
+		return err
+	}
+
+	return send(host, "request", strings.ToUpper(method), url, opts)
+}
+
+func optional(args []Object.Object, at int) Object.Object {
+	if len(args) <= at {
+		return nil
+	}
+
+	return args[at]
+}
+
+// Implemented by the error a host gives back when the program called exit
+type exitCoder interface {
+	ExitCode() int
+}
+
+/*
+serve(addr, handler) answers requests on addr, like "127.0.0.1:8080", until the program is cancelled.
+handler gets a request hash with the method, path, query, headers and body and returns a response hash,
+missing fields being a 200 status, no headers and an empty body. It may also return just the body string.
+Every request is handled at the same time as the others, on a host of its own with its own copy of the
+program's globals as they were when serve was called. What a handler changes, like adding to a global set,
+is only seen by that request.
+
+serve(addr, handler, ready) calls ready(address) once the server is listening and stops the server when ready
+returns, giving what it returned. With port 0, address has the port that was picked, which makes it easy to
+test a handler against a server of its own. A handler calling exit stops the server and the program.
+*/
+func serve(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("serve", len(args), "2 or 3")
+	}
+
+	addr, err := str("serve", args[0])
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range args[1:] {
+		switch fn.(type) {
+		case *Object.Closure, *Object.Builtin:
+		default:
+			return Object.NewBuiltinError("argument to 'serve' must be a function, got %s", fn.Type())
+		}
+	}
+
+	if err := allowed(host, "serve"); err != nil {
+		return err
+	}
+
+	listener, listenErr := net.Listen("tcp", addr)
+	if listenErr != nil {
+		return Object.NewBuiltinError("serve: %s", listenErr)
+	}
+
+	// Requests spawn from a copy no code runs on, so they can copy it while ready runs on host
+	template, fn := host.Spawn(args[1])
+
+	exits := make(chan int, 1)
+	server := &gohttp.Server{Handler: &handler{template: template, fn: fn[0], exits: exits}}
+
+	failed := make(chan error, 1)
+
+	go func() {
+		failed <- server.Serve(listener)
+	}()
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWNDELAY)
+		defer cancel()
+
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	}()
+
+	if len(args) == 3 {
+		result, callErr := host.Call(args[2], &Object.String{Value: listener.Addr().String()})
+		if callErr != nil {
+			return Object.NewCallbackError("serve", callErr)
+		}
+
+		select {
+		case code := <-exits:
+			return &Object.Exit{Code: code}
+		default:
+		}
+
+		return result
+	}
+
+	select {
+	case <-host.Done():
+		return nil
+	case code := <-exits:
+		return &Object.Exit{Code: code}
+	case serveErr := <-failed:
+		return Object.NewBuiltinError("serve: %s", serveErr)
+	}
+}
+
+// Answers every request by calling the momo handler on a host spawned for it
+type handler struct {
+	template Object.Host // Never runs anything, every request spawns from it
+	fn       Object.Object
+	exits    chan<- int
+}
+
+func (h *handler) ServeHTTP(w gohttp.ResponseWriter, r *gohttp.Request) {
+	body, readErr := io.ReadAll(r.Body)
+	if readErr != nil {
+		gohttp.Error(w, readErr.Error(), gohttp.StatusBadRequest)
+		return
+	}
+
+	values := r.URL.Query()
+	query := Object.NewHash()
+
+	for _, name := range sortedNames(values) {
+		query.Set(&Object.String{Value: name}, &Object.String{Value: values[name][0]})
+	}
+
+	req := hash([]string{"method", "path", "query", "headers", "body"},
+		&Object.String{Value: r.Method},
+		&Object.String{Value: r.URL.Path},
+		query,
+		headersHash(r.Header),
+		&Object.String{Value: string(body)},
+	)
+
+	spawned, fn := h.template.Spawn(h.fn)
+	result, callErr := spawned.Call(fn[0], req)
+
+	var exit exitCoder
+
+	if errors.As(callErr, &exit) {
+		select {
+		case h.exits <- exit.ExitCode():
+		default:
+		}
+
+		gohttp.Error(w, "the server is stopping", gohttp.StatusServiceUnavailable)
+		return
+	}
+
+	if callErr != nil {
+		gohttp.Error(w, callErr.Error(), gohttp.StatusInternalServerError)
+		return
+	}
+
+	if err := respond(w, result); err != nil {
+		gohttp.Error(w, err.Message, gohttp.StatusInternalServerError)
+	}
+}
+
+// Writes what the handler returned, nothing is written if it isn't a response
+func respond(w gohttp.ResponseWriter, result Object.Object) *Object.Error {
+	status := gohttp.StatusOK
+	headers := gohttp.Header{}
+	body := ""
+
+	switch result := result.(type) {
+	case *Object.Error:
+		return result
+
+	case *Object.String:
+		body = result.Value
+
+	case *Object.Hash:
+		for _, pair := range result.Pairs() {
+			key, ok := pair.Key.(*Object.String)
+			if !ok {
+				return Object.NewBuiltinError("response field names must be STRING, got %s", pair.Key.Type())
+			}
+
+			value := pair.Value
+
+			switch key.Value {
+			case "status":
+				code, ok := value.(*Object.Integer)
+				if !ok || code.Value < 100 || code.Value > 999 {
+					return Object.NewBuiltinError("response status must be an INTEGER between 100 and 999, got %s", value.Inspect())
+				}
+				status = int(code.Value)
+
+			case "headers":
+				if err := setHeaders("response", value, headers); err != nil {
+					return err
+				}
+
+			case "body":
+				s, ok := value.(*Object.String)
+				if !ok {
+					return Object.NewBuiltinError("response body must be STRING, got %s", value.Type())
+				}
+				body = s.Value
+
+			default:
+				return Object.NewBuiltinError("unknown response field '%s'", key.Value)
+			}
+		}
+
+	default:
+		return Object.NewBuiltinError("the handler given to 'serve' must return a HASH or a STRING, got %s", result.Type())
+	}
+
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+
+	return nil
+}
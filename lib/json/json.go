@@ -0,0 +1,299 @@
+package json
+
+import (
+	"bytes"
+	gojson "encoding/json"
+	"errors"
+	"fmt"
+	Object "github/FabioVV/comp_lang/object"
+	"io"
+	gomath "math"
+	"strconv"
+	"strings"
+)
+
+// How deep stringify goes into arrays and hashes before deciding a value contains itself
+const MAXDEPTH int = 1000
+
+/*
+The json module. Objects become hashes, arrays become arrays and numbers without a fraction or an exponent
+become integers, every other number is a float. Going back, only values JSON has a notation for can be written.
+*/
+var Json = map[string]Object.Object{
+	"parse":     &Object.Builtin{Fn: parse},
+	"stringify": &Object.Builtin{Fn: stringify},
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+// parse(text) is the value text holds
+func parse(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("parse", len(args), "1")
+	}
+
+	text, ok := args[0].(*Object.String)
+	if !ok {
+		return Object.NewBuiltinError("argument to 'parse' must be STRING, got %s", args[0].Type())
+	}
+
+	decoder := gojson.NewDecoder(strings.NewReader(text.Value))
+	decoder.UseNumber()
+
+	value, err := decode(decoder)
+	if err != nil {
+		return parseError(decoder, err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return Object.NewBuiltinError("parse: unexpected data after the value at offset %d", decoder.InputOffset())
+	}
+
+	return value
+}
+
+func parseError(decoder *gojson.Decoder, err error) *Object.Error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return Object.NewBuiltinError("parse: unexpected end of input")
+	}
+
+	return Object.NewBuiltinError("parse: %s at offset %d", err, decoder.InputOffset())
+}
+
+// Reads the next value token by token, so object keys are seen in the order they're written
+func decode(decoder *gojson.Decoder) (Object.Object, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case gojson.Delim:
+		if token == '[' {
+			return decodeArray(decoder)
+		}
+		return decodeObject(decoder)
+
+	case gojson.Number:
+		return number(token)
+
+	case string:
+		return &Object.String{Value: token}, nil
+
+	case bool:
+		return &Object.Boolean{Value: token}, nil
+
+	case nil:
+		return &Object.NULL, nil
+	}
+
+	return nil, fmt.Errorf("unexpected token %v", token)
+}
+
+func decodeArray(decoder *gojson.Decoder) (Object.Object, error) {
+	elements := []Object.Object{}
+
+	for decoder.More() {
+		element, err := decode(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, element)
+	}
+
+	// The closing ]
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return &Object.Array{Elements: elements}, nil
+}
+
+func decodeObject(decoder *gojson.Decoder) (Object.Object, error) {
+	hash := Object.NewHash()
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key := &Object.String{Value: token.(string)}
+
+		value, err := decode(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Set(key, value)
+	}
+
+	// The closing }
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+// Whole numbers stay integers unless they don't fit in one
+func number(n gojson.Number) (Object.Object, error) {
+	if !strings.ContainsAny(n.String(), ".eE") {
+		if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+			return &Object.Integer{Value: i}, nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, err
+	}
+
+	return &Object.Float{Value: f}, nil
+}
+
+/*
+stringify(value) is value as compact JSON. stringify(value, indent) puts every element on its own line,
+indented by indent, a number of spaces or the string to indent with.
+*/
+func stringify(args ...Object.Object) Object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("stringify", len(args), "1 or 2")
+	}
+
+	indent := ""
+
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *Object.Integer:
+			if arg.Value < 0 || arg.Value > 10 {
+				return Object.NewBuiltinError("'stringify' indent must be between 0 and 10 spaces, got %d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+
+		case *Object.String:
+			indent = arg.Value
+
+		default:
+			return Object.NewBuiltinError("'stringify' indent must be INTEGER or STRING, got %s", args[1].Type())
+		}
+	}
+
+	var out bytes.Buffer
+
+	if err := encode(&out, args[0], 0); err != nil {
+		return err
+	}
+
+	if indent == "" {
+		return &Object.String{Value: out.String()}
+	}
+
+	var indented bytes.Buffer
+
+	if err := gojson.Indent(&indented, out.Bytes(), "", indent); err != nil {
+		return Object.NewBuiltinError("stringify: %s", err)
+	}
+
+	return &Object.String{Value: indented.String()}
+}
+
+func encode(out *bytes.Buffer, value Object.Object, depth int) *Object.Error {
+	if depth > MAXDEPTH {
+		return Object.NewBuiltinError("stringify: value is nested more than %d levels deep, does it contain itself?", MAXDEPTH)
+	}
+
+	switch value := value.(type) {
+	case *Object.Null:
+		out.WriteString("null")
+
+	case *Object.Boolean:
+		out.WriteString(strconv.FormatBool(value.Value))
+
+	case *Object.Integer:
+		out.WriteString(strconv.FormatInt(value.Value, 10))
+
+	case *Object.Float:
+		if gomath.IsNaN(value.Value) || gomath.IsInf(value.Value, 0) {
+			return Object.NewBuiltinError("stringify: %s can't be written as JSON", value.Inspect())
+		}
+
+		// Inspect keeps the .0 of whole floats, so they're still floats when parsed back
+		out.WriteString(value.Inspect())
+
+	case *Object.String:
+		encodeString(out, value.Value)
+
+	case *Object.Array:
+		return encodeArray(out, value.Elements, depth)
+
+	// A tuple is a frozen array, JSON has no other way to write it
+	case *Object.Tuple:
+		return encodeArray(out, value.Elements, depth)
+
+	case *Object.Hash:
+		return encodeHash(out, value, depth)
+
+	default:
+		return Object.NewBuiltinError("stringify: %s values can't be written as JSON", value.Type())
+	}
+
+	return nil
+}
+
+func encodeArray(out *bytes.Buffer, elements []Object.Object, depth int) *Object.Error {
+	out.WriteByte('[')
+
+	for i, element := range elements {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+
+		if err := encode(out, element, depth+1); err != nil {
+			return err
+		}
+	}
+
+	out.WriteByte(']')
+
+	return nil
+}
+
+// Keys are written in the hash's order, so parsing a document and writing it back keeps its keys where they were
+func encodeHash(out *bytes.Buffer, hash *Object.Hash, depth int) *Object.Error {
+	out.WriteByte('{')
+
+	for i, pair := range hash.Pairs() {
+		key, ok := pair.Key.(*Object.String)
+		if !ok {
+			return Object.NewBuiltinError("stringify: JSON object keys must be STRING, got %s", pair.Key.Type())
+		}
+
+		if i > 0 {
+			out.WriteByte(',')
+		}
+
+		encodeString(out, key.Value)
+		out.WriteByte(':')
+
+		if err := encode(out, pair.Value, depth+1); err != nil {
+			return err
+		}
+	}
+
+	out.WriteByte('}')
+
+	return nil
+}
+
+func encodeString(out *bytes.Buffer, s string) {
+	encoder := gojson.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+
+	// Encode ends every value with a newline
+	out.Truncate(out.Len() - 1)
+}
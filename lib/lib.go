@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"github/FabioVV/comp_lang/lib/encoding"
+	"github/FabioVV/comp_lang/lib/fs"
+	"github/FabioVV/comp_lang/lib/http"
+	"github/FabioVV/comp_lang/lib/json"
+	"github/FabioVV/comp_lang/lib/math"
+	"github/FabioVV/comp_lang/lib/proc"
+	"github/FabioVV/comp_lang/lib/re"
+	"github/FabioVV/comp_lang/lib/strings"
+	"github/FabioVV/comp_lang/lib/time"
+	Object "github/FabioVV/comp_lang/object"
+	"sort"
+)
+
+/*
+The native modules momo code can #load by name, #load "math" binds a hash named math holding the
+module's functions and constants. Each module is a map from member names to values, functions are builtins.
+*/
+var modules = map[string]map[string]Object.Object{
+	"encoding": encoding.Encoding,
+	"fs":       fs.Fs,
+	"http":     http.Http,
+	"json":     json.Json,
+	"math":     math.Math,
+	"proc":     proc.Proc,
+	"re":       re.Re,
+	"strings":  strings.Strings,
+	"time":     time.Time,
+}
+
+func Exists(name string) bool {
+	_, ok := modules[name]
+	return ok
+}
+
+// The names of every native module, sorted
+func Names() []string {
+	names := make([]string, 0, len(modules))
+
+	for name := range modules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// The members of a module, sorted by name. Editor tooling completes and documents them with it
+func Members(name string) []string {
+	members := make([]string, 0, len(modules[name]))
+
+	for member := range modules[name] {
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+	return members
+}
+
+// Builds the hash #load binds for a module. Every #load gets its own hash so changing one can't affect another
+func Load(name string) (*Object.Hash, bool) {
+	members, ok := modules[name]
+	if !ok {
+		return nil, false
+	}
+
+	hash := Object.NewHash()
+
+	for _, member := range Members(name) {
+		hash.Set(&Object.String{Value: member}, members[member])
+	}
+
+	return hash, true
+}
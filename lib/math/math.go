@@ -1,11 +1,449 @@
 package math
 
 import (
+	"fmt"
 	Object "github/FabioVV/comp_lang/object"
+	gomath "math"
+	"math/bits"
+	"math/rand"
+	"sync"
+	"time"
 )
 
-var Math = map[string]*Object.Lib{
-	"PI": {
-		Fn: &Object.Float{Value: 3.141592},
-	},
+/*
+The math module. Functions take integers and floats alike. floor, ceil, round, gcd, lcm and rand_int return
+integers. abs keeps the type it's given, and min and max return the winning argument as it was given, so
+max(1, 2.5) is 2.5 and max(3, 1.5) is 3. Everything else returns floats.
+Arguments outside a function's domain give an error instead of nan.
+*/
+var Math = map[string]Object.Object{
+	"pi":  &Object.Float{Value: gomath.Pi},
+	"e":   &Object.Float{Value: gomath.E},
+	"inf": &Object.Float{Value: gomath.Inf(1)},
+	"nan": &Object.Float{Value: gomath.NaN()},
+
+	"sqrt":  &Object.Builtin{Fn: sqrt},
+	"pow":   &Object.Builtin{Fn: pow},
+	"abs":   &Object.Builtin{Fn: abs},
+	"floor": &Object.Builtin{Fn: rounding("floor", gomath.Floor)},
+	"ceil":  &Object.Builtin{Fn: rounding("ceil", gomath.Ceil)},
+	"round": &Object.Builtin{Fn: rounding("round", gomath.Round)},
+
+	"sin":   &Object.Builtin{Fn: float1("sin", gomath.Sin, anything)},
+	"cos":   &Object.Builtin{Fn: float1("cos", gomath.Cos, anything)},
+	"tan":   &Object.Builtin{Fn: float1("tan", gomath.Tan, anything)},
+	"asin":  &Object.Builtin{Fn: float1("asin", gomath.Asin, between(-1, 1))},
+	"acos":  &Object.Builtin{Fn: float1("acos", gomath.Acos, between(-1, 1))},
+	"atan":  &Object.Builtin{Fn: float1("atan", gomath.Atan, anything)},
+	"atan2": &Object.Builtin{Fn: atan2},
+	"exp":   &Object.Builtin{Fn: float1("exp", gomath.Exp, anything)},
+	"log":   &Object.Builtin{Fn: float1("log", gomath.Log, positive)},
+	"log2":  &Object.Builtin{Fn: float1("log2", gomath.Log2, positive)},
+	"log10": &Object.Builtin{Fn: float1("log10", gomath.Log10, positive)},
+
+	"min": &Object.Builtin{Fn: extreme("min", func(a, b float64) bool { return a < b })},
+	"max": &Object.Builtin{Fn: extreme("max", func(a, b float64) bool { return a > b })},
+	"gcd": &Object.Builtin{Fn: gcd},
+	"lcm": &Object.Builtin{Fn: lcm},
+
+	"seed":     &Object.Builtin{Fn: seed},
+	"random":   &Object.Builtin{Fn: random},
+	"rand_int": &Object.Builtin{Fn: randInt},
+}
+
+// The numeric value of an integer or a float argument
+func number(name string, arg Object.Object) (float64, *Object.Error) {
+	switch arg := arg.(type) {
+	case *Object.Integer:
+		return float64(arg.Value), nil
+	case *Object.Float:
+		return arg.Value, nil
+	}
+
+	return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER or FLOAT, got %s", name, arg.Type())
+}
+
+func integer(name string, arg Object.Object) (int64, *Object.Error) {
+	i, ok := arg.(*Object.Integer)
+	if !ok {
+		return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER, got %s", name, arg.Type())
+	}
+
+	return i.Value, nil
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+// Domains of the float functions, they return what's wrong with x or an empty string
+type domain func(x float64) string
+
+func anything(x float64) string { return "" }
+
+func positive(x float64) string {
+	if x <= 0 {
+		return "must be greater than 0"
+	}
+	return ""
+}
+
+func between(min, max float64) domain {
+	return func(x float64) string {
+		if x < min || x > max {
+			return fmt.Sprintf("must be between %g and %g", min, max)
+		}
+		return ""
+	}
+}
+
+// A builtin taking one number and returning fn of it as a float
+func float1(name string, fn func(float64) float64, check domain) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 1 {
+			return wrongArgs(name, len(args), "1")
+		}
+
+		x, err := number(name, args[0])
+		if err != nil {
+			return err
+		}
+
+		if problem := check(x); problem != "" {
+			return Object.NewBuiltinError("math domain error: argument to '%s' %s, got %s", name, problem, args[0].Inspect())
+		}
+
+		return &Object.Float{Value: fn(x)}
+	}
+}
+
+func sqrt(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("sqrt", len(args), "1")
+	}
+
+	x, err := number("sqrt", args[0])
+	if err != nil {
+		return err
+	}
+
+	if x < 0 {
+		return Object.NewBuiltinError("math domain error: square root of negative number %s", args[0].Inspect())
+	}
+
+	return &Object.Float{Value: gomath.Sqrt(x)}
+}
+
+func atan2(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("atan2", len(args), "2")
+	}
+
+	y, err := number("atan2", args[0])
+	if err != nil {
+		return err
+	}
+
+	x, err := number("atan2", args[1])
+	if err != nil {
+		return err
+	}
+
+	return &Object.Float{Value: gomath.Atan2(y, x)}
+}
+
+// pow(base, exponent) is an integer when both are integers and the exponent isn't negative
+func pow(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("pow", len(args), "2")
+	}
+
+	base, baseOk := args[0].(*Object.Integer)
+	exponent, exponentOk := args[1].(*Object.Integer)
+
+	if baseOk && exponentOk && exponent.Value >= 0 {
+		result, ok := intPow(base.Value, exponent.Value)
+		if !ok {
+			return Object.NewBuiltinError("integer overflow: pow(%d, %d) doesn't fit in an integer, use a float base", base.Value, exponent.Value)
+		}
+
+		return &Object.Integer{Value: result}
+	}
+
+	x, err := number("pow", args[0])
+	if err != nil {
+		return err
+	}
+
+	y, err := number("pow", args[1])
+	if err != nil {
+		return err
+	}
+
+	if x < 0 && y != gomath.Trunc(y) {
+		return Object.NewBuiltinError("math domain error: negative base %s with fractional exponent %s", args[0].Inspect(), args[1].Inspect())
+	}
+
+	if x == 0 && y < 0 {
+		return Object.NewBuiltinError("math domain error: zero raised to negative exponent %s", args[1].Inspect())
+	}
+
+	return &Object.Float{Value: gomath.Pow(x, y)}
+}
+
+// Exponentiation by squaring, false if the result overflows
+func intPow(base int64, exponent int64) (int64, bool) {
+	result := int64(1)
+
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			r, ok := mulInt(result, base)
+			if !ok {
+				return 0, false
+			}
+			result = r
+		}
+
+		exponent >>= 1
+
+		if exponent > 0 {
+			b, ok := mulInt(base, base)
+			if !ok {
+				return 0, false
+			}
+			base = b
+		}
+	}
+
+	return result, true
+}
+
+func mulInt(a int64, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	result := a * b
+	if result/b != a || a == -1 && b == gomath.MinInt64 || b == -1 && a == gomath.MinInt64 {
+		return 0, false
+	}
+
+	return result, true
+}
+
+func abs(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("abs", len(args), "1")
+	}
+
+	switch arg := args[0].(type) {
+	case *Object.Integer:
+		if arg.Value == gomath.MinInt64 {
+			return Object.NewBuiltinError("integer overflow: abs(%d) doesn't fit in an integer", arg.Value)
+		}
+
+		if arg.Value < 0 {
+			return &Object.Integer{Value: -arg.Value}
+		}
+		return arg
+
+	case *Object.Float:
+		return &Object.Float{Value: gomath.Abs(arg.Value)}
+	}
+
+	return Object.NewBuiltinError("argument to 'abs' must be INTEGER or FLOAT, got %s", args[0].Type())
+}
+
+// floor, ceil and round turn a number into the integer fn rounds it to. round rounds halves away from zero
+func rounding(name string, fn func(float64) float64) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 1 {
+			return wrongArgs(name, len(args), "1")
+		}
+
+		switch arg := args[0].(type) {
+		case *Object.Integer:
+			return arg
+
+		case *Object.Float:
+			rounded := fn(arg.Value)
+
+			if gomath.IsNaN(rounded) || rounded < gomath.MinInt64 || rounded >= gomath.MaxInt64 {
+				return Object.NewBuiltinError("math domain error: %s(%s) isn't an integer", name, arg.Inspect())
+			}
+
+			return &Object.Integer{Value: int64(rounded)}
+		}
+
+		return Object.NewBuiltinError("argument to '%s' must be INTEGER or FLOAT, got %s", name, args[0].Type())
+	}
+}
+
+// min and max take any number of numbers, or a single array of them, and return the winning argument as it is
+func extreme(name string, better func(a, b float64) bool) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) == 1 {
+			if arr, ok := args[0].(*Object.Array); ok {
+				args = arr.Elements
+			}
+		}
+
+		if len(args) == 0 {
+			return Object.NewBuiltinError("'%s' needs at least one number", name)
+		}
+
+		best := args[0]
+		bestValue, err := number(name, best)
+		if err != nil {
+			return err
+		}
+
+		for _, arg := range args[1:] {
+			value, err := number(name, arg)
+			if err != nil {
+				return err
+			}
+
+			if better(value, bestValue) || gomath.IsNaN(value) {
+				best, bestValue = arg, value
+			}
+		}
+
+		return best
+	}
+}
+
+func gcdInt(a uint64, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func absUint(x int64) uint64 {
+	if x < 0 {
+		return uint64(-x)
+	}
+	return uint64(x)
+}
+
+// gcd(a, b) is never negative, gcd(0, 0) is 0
+func gcd(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("gcd", len(args), "2")
+	}
+
+	a, err := integer("gcd", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := integer("gcd", args[1])
+	if err != nil {
+		return err
+	}
+
+	result := gcdInt(absUint(a), absUint(b))
+	if result > gomath.MaxInt64 {
+		return Object.NewBuiltinError("integer overflow: gcd(%d, %d) doesn't fit in an integer", a, b)
+	}
+
+	return &Object.Integer{Value: int64(result)}
+}
+
+// lcm(a, b) is never negative, it's 0 if either is 0
+func lcm(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("lcm", len(args), "2")
+	}
+
+	a, err := integer("lcm", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := integer("lcm", args[1])
+	if err != nil {
+		return err
+	}
+
+	if a == 0 || b == 0 {
+		return &Object.Integer{Value: 0}
+	}
+
+	x, y := absUint(a), absUint(b)
+
+	hi, result := bits.Mul64(x/gcdInt(x, y), y)
+	if hi != 0 || result > gomath.MaxInt64 {
+		return Object.NewBuiltinError("integer overflow: lcm(%d, %d) doesn't fit in an integer", a, b)
+	}
+
+	return &Object.Integer{Value: int64(result)}
+}
+
+// The generator behind random and rand_int, seeded from the clock until seed is called
+var (
+	generator   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	generatorMu sync.Mutex
+)
+
+// seed(n) makes random and rand_int return the same sequence every time the program runs
+func seed(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("seed", len(args), "1")
+	}
+
+	n, err := integer("seed", args[0])
+	if err != nil {
+		return err
+	}
+
+	generatorMu.Lock()
+	generator.Seed(n)
+	generatorMu.Unlock()
+
+	return nil
+}
+
+// random() is a float in [0, 1)
+func random(args ...Object.Object) Object.Object {
+	if len(args) != 0 {
+		return wrongArgs("random", len(args), "0")
+	}
+
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+
+	return &Object.Float{Value: generator.Float64()}
+}
+
+// rand_int(min, max) is an integer between min and max, both included
+func randInt(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("rand_int", len(args), "2")
+	}
+
+	min, err := integer("rand_int", args[0])
+	if err != nil {
+		return err
+	}
+
+	max, err := integer("rand_int", args[1])
+	if err != nil {
+		return err
+	}
+
+	if min > max {
+		return Object.NewBuiltinError("rand_int needs min <= max, got min=%d max=%d", min, max)
+	}
+
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+
+	span := uint64(max) - uint64(min)
+	if span == gomath.MaxUint64 {
+		return &Object.Integer{Value: int64(generator.Uint64())}
+	}
+
+	return &Object.Integer{Value: min + int64(generator.Uint64()%(span+1))}
 }
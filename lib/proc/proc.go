@@ -0,0 +1,372 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	Object "github/FabioVV/comp_lang/object"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long to wait for the output of a command that finished or was killed, in case something it started holds on to it
+const WAITDELAY = 500 * time.Millisecond
+
+/*
+The proc module runs other programs. Commands are run directly, not through a shell, with their arguments
+given as an array. Options are a hash that may have:
+
+	dir     the working directory
+	env     a hash of environment variables set on top of the current ones
+	stdin   a string fed to the command's input
+	timeout milliseconds after which the command is killed
+
+Hosts can take the proc capability away, every function then gives an error instead of running anything.
+*/
+var Proc = map[string]Object.Object{
+	"run":    &Object.Builtin{HostFn: run},
+	"stream": &Object.Builtin{HostFn: stream},
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+// What the options hash asked for
+type options struct {
+	dir     string
+	stdin   *string
+	env     []string // NAME=value, added after the inherited variables so they win
+	timeout time.Duration
+}
+
+func parseOptions(name string, arg Object.Object) (*options, *Object.Error) {
+	opts := &options{}
+
+	if arg == nil {
+		return opts, nil
+	}
+
+	h, ok := arg.(*Object.Hash)
+	if !ok {
+		return nil, Object.NewBuiltinError("options to '%s' must be a HASH, got %s", name, arg.Type())
+	}
+
+	for _, pair := range h.Pairs() {
+		key, ok := pair.Key.(*Object.String)
+		if !ok {
+			return nil, Object.NewBuiltinError("'%s' option names must be STRING, got %s", name, pair.Key.Type())
+		}
+
+		switch key.Value {
+		case "dir", "stdin":
+			value, ok := pair.Value.(*Object.String)
+			if !ok {
+				return nil, Object.NewBuiltinError("'%s' option %s must be STRING, got %s", name, key.Value, pair.Value.Type())
+			}
+
+			if key.Value == "dir" {
+				opts.dir = value.Value
+			} else {
+				opts.stdin = &value.Value
+			}
+
+		case "env":
+			env, ok := pair.Value.(*Object.Hash)
+			if !ok {
+				return nil, Object.NewBuiltinError("'%s' option env must be a HASH, got %s", name, pair.Value.Type())
+			}
+
+			for _, variable := range env.Pairs() {
+				k, keyOk := variable.Key.(*Object.String)
+				v, valueOk := variable.Value.(*Object.String)
+
+				if !keyOk || !valueOk {
+					return nil, Object.NewBuiltinError("'%s' option env must map STRING to STRING, got %s: %s", name, variable.Key.Type(), variable.Value.Type())
+				}
+
+				opts.env = append(opts.env, k.Value+"="+v.Value)
+			}
+
+		case "timeout":
+			ms, ok := pair.Value.(*Object.Integer)
+			if !ok || ms.Value <= 0 {
+				return nil, Object.NewBuiltinError("'%s' option timeout must be a positive INTEGER of milliseconds, got %s", name, pair.Value.Inspect())
+			}
+
+			opts.timeout = time.Duration(ms.Value) * time.Millisecond
+
+		default:
+			return nil, Object.NewBuiltinError("unknown option '%s' for '%s'", key.Value, name)
+		}
+	}
+
+	return opts, nil
+}
+
+// A command ready to start, with the context that kills it on timeout or when the VM is cancelled
+type command struct {
+	cmd     *exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+// Builds the command from the program name, its arguments and the options hash, either may be nil
+func newCommand(host Object.Host, name string, program Object.Object, arguments Object.Object, optionsArg Object.Object) (*command, *Object.Error) {
+	if !host.Allows(Object.CAPABILITYPROC) {
+		return nil, Object.NewBuiltinError("%s: running programs isn't allowed here", name)
+	}
+
+	path, err := str(name, program)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+
+	if arguments != nil {
+		arr, ok := arguments.(*Object.Array)
+		if !ok {
+			return nil, Object.NewBuiltinError("arguments to '%s' must be an ARRAY, got %s", name, arguments.Type())
+		}
+
+		for i, el := range arr.Elements {
+			s, ok := el.(*Object.String)
+			if !ok {
+				return nil, Object.NewBuiltinError("'%s' needs an array of STRING arguments, argument %d is %s", name, i, el.Type())
+			}
+			args = append(args, s.Value)
+		}
+	}
+
+	opts, err := parseOptions(name, optionsArg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &command{timeout: opts.timeout}
+
+	if opts.timeout > 0 {
+		c.ctx, c.cancel = context.WithTimeout(context.Background(), opts.timeout)
+	} else {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+
+	// Stopping the program stops the commands it's waiting on
+	go func() {
+		select {
+		case <-host.Done():
+			c.cancel()
+		case <-c.ctx.Done():
+		}
+	}()
+
+	c.cmd = exec.CommandContext(c.ctx, path, args...)
+	c.cmd.Dir = opts.dir
+	c.cmd.WaitDelay = WAITDELAY
+
+	if opts.stdin != nil {
+		c.cmd.Stdin = strings.NewReader(*opts.stdin)
+	}
+
+	if opts.env != nil {
+		c.cmd.Env = append(os.Environ(), opts.env...)
+	}
+
+	return c, nil
+}
+
+/*
+The exit code once the command finished. A command that couldn't start or ran out of time is an error,
+one that failed is not, its exit code says so.
+*/
+func (c *command) exitCode(name string, err error) (int64, *Object.Error) {
+	if c.timeout > 0 && errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		return 0, Object.NewBuiltinError("%s: %s timed out after %s", name, c.cmd.Path, c.timeout)
+	}
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return int64(exitErr.ExitCode()), nil
+	}
+
+	if err != nil {
+		return 0, Object.NewBuiltinError("%s: %s", name, err)
+	}
+
+	return 0, nil
+}
+
+// Splits the optional arguments after the program name, args is an array and options a hash
+func optional(args []Object.Object) (Object.Object, Object.Object) {
+	var arguments, options Object.Object
+
+	if len(args) > 0 {
+		arguments = args[0]
+	}
+
+	if len(args) > 1 {
+		options = args[1]
+	}
+
+	return arguments, options
+}
+
+// run(program, args, options) waits for the program and gives a hash with its stdout, stderr and exit code
+func run(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return wrongArgs("run", len(args), "1 to 3")
+	}
+
+	arguments, options := optional(args[1:])
+
+	c, err := newCommand(host, "run", args[0], arguments, options)
+	if err != nil {
+		return err
+	}
+	defer c.cancel()
+
+	var stdout, stderr bytes.Buffer
+	c.cmd.Stdout = &stdout
+	c.cmd.Stderr = &stderr
+
+	code, err := c.exitCode("run", c.cmd.Run())
+	if err != nil {
+		return err
+	}
+
+	result := Object.NewHash()
+	result.Set(&Object.String{Value: "stdout"}, &Object.String{Value: stdout.String()})
+	result.Set(&Object.String{Value: "stderr"}, &Object.String{Value: stderr.String()})
+	result.Set(&Object.String{Value: "code"}, &Object.Integer{Value: code})
+
+	return result
+}
+
+// A line the program wrote and where, "stdout" or "stderr"
+type output struct {
+	line   string
+	source string
+}
+
+/*
+stream(program, fn, args, options) calls fn(line, source) with every line the program writes as it writes it,
+source being "stdout" or "stderr", and gives the exit code. fn returning false kills the program.
+*/
+func stream(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) < 2 || len(args) > 4 {
+		return wrongArgs("stream", len(args), "2 to 4")
+	}
+
+	fn := args[1]
+
+	switch fn.(type) {
+	case *Object.Closure, *Object.Builtin:
+	default:
+		return Object.NewBuiltinError("argument to 'stream' must be a function, got %s", fn.Type())
+	}
+
+	arguments, options := optional(args[2:])
+
+	c, err := newCommand(host, "stream", args[0], arguments, options)
+	if err != nil {
+		return err
+	}
+	defer c.cancel()
+
+	stdout, pipeErr := c.cmd.StdoutPipe()
+	if pipeErr != nil {
+		return Object.NewBuiltinError("stream: %s", pipeErr)
+	}
+
+	stderr, pipeErr := c.cmd.StderrPipe()
+	if pipeErr != nil {
+		return Object.NewBuiltinError("stream: %s", pipeErr)
+	}
+
+	if startErr := c.cmd.Start(); startErr != nil {
+		return Object.NewBuiltinError("stream: %s", startErr)
+	}
+
+	// The pipes are read on their own goroutines, fn is only ever called from this one since it runs on the VM
+	lines := make(chan output)
+	stop := make(chan struct{})
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+
+	go readLines(stdout, "stdout", lines, stop, &readers)
+	go readLines(stderr, "stderr", lines, stop, &readers)
+
+	go func() {
+		readers.Wait()
+		close(lines)
+	}()
+
+	var failure Object.Object
+
+	for out := range lines {
+		result, callErr := host.Call(fn, &Object.String{Value: out.line}, &Object.String{Value: out.source})
+
+		if callErr != nil {
+			failure = Object.NewCallbackError("stream", callErr)
+		}
+
+		// Wait closes the pipes, which ends the readers once the program is killed
+		if b, ok := result.(*Object.Boolean); callErr != nil || ok && !b.Value {
+			close(stop)
+			c.cancel()
+			break
+		}
+	}
+
+	code, err := c.exitCode("stream", c.cmd.Wait())
+
+	if failure != nil {
+		return failure
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return &Object.Integer{Value: code}
+}
+
+func readLines(r io.Reader, source string, lines chan<- output, stop <-chan struct{}, readers *sync.WaitGroup) {
+	defer readers.Done()
+
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if line != "" {
+			select {
+			case lines <- output{line: strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), source: source}:
+			case <-stop:
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package re
+
+import (
+	Object "github/FabioVV/comp_lang/object"
+	"regexp"
+)
+
+/*
+The re module, regular expressions with Go's RE2 syntax. compile(pattern) makes a regex once, every other
+function takes either a regex or a pattern string, which is compiled on every call.
+
+A match is an array holding the whole match followed by each capture group, null for groups that didn't
+take part in it. Bad patterns give an error pointing at the line that used them.
+*/
+var Re = map[string]Object.Object{
+	"compile":    &Object.Builtin{HostFn: compile},
+	"match":      &Object.Builtin{HostFn: match},
+	"find":       &Object.Builtin{HostFn: find},
+	"find_all":   &Object.Builtin{HostFn: findAll},
+	"find_named": &Object.Builtin{HostFn: findNamed},
+	"replace":    &Object.Builtin{HostFn: replace},
+	"split":      &Object.Builtin{HostFn: split},
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+// The regex a function was given, compiling it if it's a pattern
+func regex(host Object.Host, name string, arg Object.Object) (*regexp.Regexp, *Object.Error) {
+	switch arg := arg.(type) {
+	case *Object.Regex:
+		return arg.Regexp, nil
+
+	case *Object.String:
+		r, err := regexp.Compile(arg.Value)
+		if err != nil {
+			pos := host.Position()
+
+			return nil, &Object.Error{
+				Message:  name + ": " + err.Error(),
+				Filename: pos.Filename,
+				Line:     pos.Line,
+				Column:   pos.Column,
+			}
+		}
+
+		return r, nil
+	}
+
+	return nil, Object.NewBuiltinError("argument to '%s' must be REGEX or STRING, got %s", name, arg.Type())
+}
+
+// The regex and the string every function but compile starts with
+func regexAndString(host Object.Host, name string, args []Object.Object) (*regexp.Regexp, string, *Object.Error) {
+	r, err := regex(host, name, args[0])
+	if err != nil {
+		return nil, "", err
+	}
+
+	s, err := str(name, args[1])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return r, s, nil
+}
+
+// The optional last argument limiting how many matches are used, -1 means all of them
+func limit(name string, args []Object.Object, at int) (int, *Object.Error) {
+	if len(args) <= at {
+		return -1, nil
+	}
+
+	n, ok := args[at].(*Object.Integer)
+	if !ok {
+		return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER, got %s", name, args[at].Type())
+	}
+
+	return int(n.Value), nil
+}
+
+// The match array for the submatch indexes Go found in s
+func matchArray(s string, loc []int) *Object.Array {
+	elements := make([]Object.Object, len(loc)/2)
+
+	for i := range elements {
+		if loc[2*i] < 0 {
+			elements[i] = &Object.NULL
+			continue
+		}
+
+		elements[i] = &Object.String{Value: s[loc[2*i]:loc[2*i+1]]}
+	}
+
+	return &Object.Array{Elements: elements}
+}
+
+func compile(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("compile", len(args), "1")
+	}
+
+	if _, ok := args[0].(*Object.String); !ok {
+		return Object.NewBuiltinError("argument to 'compile' must be STRING, got %s", args[0].Type())
+	}
+
+	r, err := regex(host, "compile", args[0])
+	if err != nil {
+		return err
+	}
+
+	return &Object.Regex{Regexp: r}
+}
+
+// match(regex, s) is whether the regex matches anywhere in s, anchor it with ^ and $ to match all of s
+func match(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("match", len(args), "2")
+	}
+
+	r, s, err := regexAndString(host, "match", args)
+	if err != nil {
+		return err
+	}
+
+	return &Object.Boolean{Value: r.MatchString(s)}
+}
+
+// find(regex, s) is the first match in s, null if there's none
+func find(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("find", len(args), "2")
+	}
+
+	r, s, err := regexAndString(host, "find", args)
+	if err != nil {
+		return err
+	}
+
+	loc := r.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil
+	}
+
+	return matchArray(s, loc)
+}
+
+// find_all(regex, s) is every match in s, find_all(regex, s, n) at most the first n
+func findAll(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("find_all", len(args), "2 or 3")
+	}
+
+	r, s, err := regexAndString(host, "find_all", args)
+	if err != nil {
+		return err
+	}
+
+	n, err := limit("find_all", args, 2)
+	if err != nil {
+		return err
+	}
+
+	matches := []Object.Object{}
+
+	for _, loc := range r.FindAllStringSubmatchIndex(s, n) {
+		matches = append(matches, matchArray(s, loc))
+	}
+
+	return &Object.Array{Elements: matches}
+}
+
+// find_named(regex, s) is a hash from the names of the regex's (?P<name>...) groups to what they matched
+func findNamed(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("find_named", len(args), "2")
+	}
+
+	r, s, err := regexAndString(host, "find_named", args)
+	if err != nil {
+		return err
+	}
+
+	loc := r.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil
+	}
+
+	groups := matchArray(s, loc).Elements
+	named := Object.NewHash()
+
+	for i, name := range r.SubexpNames() {
+		if name == "" {
+			continue
+		}
+
+		named.Set(&Object.String{Value: name}, groups[i])
+	}
+
+	return named
+}
+
+/*
+replace(regex, s, with) replaces every match in s. with is either a string, where $1 or ${name} stand for
+the groups, or a function that gets the match array and returns the string to put in its place.
+*/
+func replace(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 3 {
+		return wrongArgs("replace", len(args), "3")
+	}
+
+	r, s, err := regexAndString(host, "replace", args)
+	if err != nil {
+		return err
+	}
+
+	switch with := args[2].(type) {
+	case *Object.String:
+		return &Object.String{Value: r.ReplaceAllString(s, with.Value)}
+
+	case *Object.Closure, *Object.Builtin:
+		return replaceFunc(host, r, s, with)
+	}
+
+	return Object.NewBuiltinError("argument to 'replace' must be STRING or a function, got %s", args[2].Type())
+}
+
+func replaceFunc(host Object.Host, r *regexp.Regexp, s string, fn Object.Object) Object.Object {
+	var out []byte
+	last := 0
+
+	for _, loc := range r.FindAllStringSubmatchIndex(s, -1) {
+		result, callErr := host.Call(fn, matchArray(s, loc))
+		if callErr != nil {
+			return Object.NewCallbackError("replace", callErr)
+		}
+
+		if e, ok := result.(*Object.Error); ok {
+			return e
+		}
+
+		replacement, ok := result.(*Object.String)
+		if !ok {
+			return Object.NewBuiltinError("the function given to 'replace' must return STRING, got %s", result.Type())
+		}
+
+		out = append(out, s[last:loc[0]]...)
+		out = append(out, replacement.Value...)
+		last = loc[1]
+	}
+
+	out = append(out, s[last:]...)
+
+	return &Object.String{Value: string(out)}
+}
+
+// split(regex, s) splits s around every match, split(regex, s, n) into at most n pieces
+func split(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("split", len(args), "2 or 3")
+	}
+
+	r, s, err := regexAndString(host, "split", args)
+	if err != nil {
+		return err
+	}
+
+	n, err := limit("split", args, 2)
+	if err != nil {
+		return err
+	}
+
+	pieces := []Object.Object{}
+
+	for _, piece := range r.Split(s, n) {
+		pieces = append(pieces, &Object.String{Value: piece})
+	}
+
+	return &Object.Array{Elements: pieces}
+}
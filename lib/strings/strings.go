@@ -0,0 +1,351 @@
+package strings
+
+import (
+	Object "github/FabioVV/comp_lang/object"
+	gomath "math"
+	gostrings "strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+The strings module. Strings are sequences of characters, not bytes: indexes, widths and chars count
+Unicode code points, so "ação" has 4 chars and index_of("ação", "o") is 3.
+*/
+var Strings = map[string]Object.Object{
+	"split":      &Object.Builtin{Fn: split},
+	"join":       &Object.Builtin{Fn: join},
+	"replace":    &Object.Builtin{Fn: replace},
+	"trim":       &Object.Builtin{Fn: trimming("trim", gostrings.TrimFunc)},
+	"trim_left":  &Object.Builtin{Fn: trimming("trim_left", gostrings.TrimLeftFunc)},
+	"trim_right": &Object.Builtin{Fn: trimming("trim_right", gostrings.TrimRightFunc)},
+	"upper":      &Object.Builtin{Fn: mapping("upper", gostrings.ToUpper)},
+	"lower":      &Object.Builtin{Fn: mapping("lower", gostrings.ToLower)},
+
+	"contains":    &Object.Builtin{Fn: test("contains", gostrings.Contains)},
+	"starts_with": &Object.Builtin{Fn: test("starts_with", gostrings.HasPrefix)},
+	"ends_with":   &Object.Builtin{Fn: test("ends_with", gostrings.HasSuffix)},
+	"index_of":    &Object.Builtin{Fn: indexOf},
+
+	"repeat":    &Object.Builtin{Fn: repeat},
+	"pad_left":  &Object.Builtin{Fn: padding("pad_left", true)},
+	"pad_right": &Object.Builtin{Fn: padding("pad_right", false)},
+	"lines":     &Object.Builtin{Fn: lines},
+	"chars":     &Object.Builtin{Fn: chars},
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+func integer(name string, arg Object.Object) (int64, *Object.Error) {
+	i, ok := arg.(*Object.Integer)
+	if !ok {
+		return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER, got %s", name, arg.Type())
+	}
+
+	return i.Value, nil
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+// The first n arguments as strings
+func strs(name string, args []Object.Object, n int) ([]string, *Object.Error) {
+	values := make([]string, n)
+
+	for i := 0; i < n; i++ {
+		s, err := str(name, args[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = s
+	}
+
+	return values, nil
+}
+
+func array(values []string) *Object.Array {
+	elements := make([]Object.Object, len(values))
+
+	for i, v := range values {
+		elements[i] = &Object.String{Value: v}
+	}
+
+	return &Object.Array{Elements: elements}
+}
+
+func boolean(b bool) *Object.Boolean {
+	return &Object.Boolean{Value: b}
+}
+
+// split(s, sep) splits s around every sep, an empty sep splits it into chars. split(s) splits around runs of whitespace
+func split(args ...Object.Object) Object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("split", len(args), "1 or 2")
+	}
+
+	values, err := strs("split", args, len(args))
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 1 {
+		return array(gostrings.Fields(values[0]))
+	}
+
+	return array(gostrings.Split(values[0], values[1]))
+}
+
+// join(array, sep) puts sep between the strings in array
+func join(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("join", len(args), "2")
+	}
+
+	arr, ok := args[0].(*Object.Array)
+	if !ok {
+		return Object.NewBuiltinError("argument to 'join' must be ARRAY, got %s", args[0].Type())
+	}
+
+	sep, err := str("join", args[1])
+	if err != nil {
+		return err
+	}
+
+	values := make([]string, len(arr.Elements))
+
+	for i, el := range arr.Elements {
+		s, ok := el.(*Object.String)
+		if !ok {
+			return Object.NewBuiltinError("'join' needs an array of STRING, element %d is %s", i, el.Type())
+		}
+		values[i] = s.Value
+	}
+
+	return &Object.String{Value: gostrings.Join(values, sep)}
+}
+
+// replace(s, old, new) replaces every old in s, replace(s, old, new, n) only the first n
+func replace(args ...Object.Object) Object.Object {
+	if len(args) != 3 && len(args) != 4 {
+		return wrongArgs("replace", len(args), "3 or 4")
+	}
+
+	values, err := strs("replace", args, 3)
+	if err != nil {
+		return err
+	}
+
+	n := int64(-1)
+
+	if len(args) == 4 {
+		if n, err = integer("replace", args[3]); err != nil {
+			return err
+		}
+
+		if n < 0 {
+			return Object.NewBuiltinError("'replace' needs a count >= 0, got %d", n)
+		}
+	}
+
+	return &Object.String{Value: gostrings.Replace(values[0], values[1], values[2], int(n))}
+}
+
+// trim(s) removes whitespace from the ends of s, trim(s, chars) removes any of the chars instead
+func trimming(name string, fn func(string, func(rune) bool) string) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 1 && len(args) != 2 {
+			return wrongArgs(name, len(args), "1 or 2")
+		}
+
+		values, err := strs(name, args, len(args))
+		if err != nil {
+			return err
+		}
+
+		cut := unicode.IsSpace
+		if len(values) == 2 {
+			cut = func(r rune) bool { return gostrings.ContainsRune(values[1], r) }
+		}
+
+		return &Object.String{Value: fn(values[0], cut)}
+	}
+}
+
+func mapping(name string, fn func(string) string) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 1 {
+			return wrongArgs(name, len(args), "1")
+		}
+
+		s, err := str(name, args[0])
+		if err != nil {
+			return err
+		}
+
+		return &Object.String{Value: fn(s)}
+	}
+}
+
+func test(name string, fn func(string, string) bool) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 2 {
+			return wrongArgs(name, len(args), "2")
+		}
+
+		values, err := strs(name, args, 2)
+		if err != nil {
+			return err
+		}
+
+		return boolean(fn(values[0], values[1]))
+	}
+}
+
+// index_of(s, sub) is the char index of the first sub in s, -1 if there's none
+func indexOf(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("index_of", len(args), "2")
+	}
+
+	values, err := strs("index_of", args, 2)
+	if err != nil {
+		return err
+	}
+
+	i := gostrings.Index(values[0], values[1])
+	if i < 0 {
+		return &Object.Integer{Value: -1}
+	}
+
+	return &Object.Integer{Value: int64(utf8.RuneCountInString(values[0][:i]))}
+}
+
+func repeat(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("repeat", len(args), "2")
+	}
+
+	s, err := str("repeat", args[0])
+	if err != nil {
+		return err
+	}
+
+	n, err := integer("repeat", args[1])
+	if err != nil {
+		return err
+	}
+
+	if n < 0 {
+		return Object.NewBuiltinError("'repeat' needs a count >= 0, got %d", n)
+	}
+
+	if len(s) > 0 && n > gomath.MaxInt32/int64(len(s)) {
+		return Object.NewBuiltinError("'repeat' result would be too long, %d times %d bytes", n, len(s))
+	}
+
+	return &Object.String{Value: gostrings.Repeat(s, int(n))}
+}
+
+/*
+pad_left(s, width) adds spaces before s until it's width chars long, pad_left(s, width, pad) repeats pad instead,
+cutting the last copy short if needed. s is returned as it is when it's already that long.
+*/
+func padding(name string, left bool) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) != 2 && len(args) != 3 {
+			return wrongArgs(name, len(args), "2 or 3")
+		}
+
+		s, err := str(name, args[0])
+		if err != nil {
+			return err
+		}
+
+		width, err := integer(name, args[1])
+		if err != nil {
+			return err
+		}
+
+		pad := " "
+		if len(args) == 3 {
+			if pad, err = str(name, args[2]); err != nil {
+				return err
+			}
+
+			if pad == "" {
+				return Object.NewBuiltinError("'%s' needs a non-empty pad", name)
+			}
+		}
+
+		missing := width - int64(utf8.RuneCountInString(s))
+		if missing <= 0 {
+			return args[0]
+		}
+
+		if missing > gomath.MaxInt32 {
+			return Object.NewBuiltinError("'%s' width %d is too large", name, width)
+		}
+
+		padRunes := []rune(pad)
+		fill := make([]rune, missing)
+		for i := range fill {
+			fill[i] = padRunes[i%len(padRunes)]
+		}
+
+		if left {
+			return &Object.String{Value: string(fill) + s}
+		}
+
+		return &Object.String{Value: s + string(fill)}
+	}
+}
+
+// lines(s) splits s at line breaks, \n or \r\n. A break at the very end doesn't start another line
+func lines(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("lines", len(args), "1")
+	}
+
+	s, err := str("lines", args[0])
+	if err != nil {
+		return err
+	}
+
+	if s == "" {
+		return array(nil)
+	}
+
+	values := gostrings.Split(gostrings.TrimSuffix(s, "\n"), "\n")
+
+	for i, v := range values {
+		values[i] = gostrings.TrimSuffix(v, "\r")
+	}
+
+	return array(values)
+}
+
+func chars(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("chars", len(args), "1")
+	}
+
+	s, err := str("chars", args[0])
+	if err != nil {
+		return err
+	}
+
+	values := []string{}
+	for _, r := range s {
+		values = append(values, string(r))
+	}
+
+	return array(values)
+}
@@ -0,0 +1,310 @@
+package time
+
+import (
+	Object "github/FabioVV/comp_lang/object"
+	gomath "math"
+	gotime "time"
+)
+
+/*
+The time module. Instants are TIME values, durations are numbers of milliseconds, so
+time.add(t, 2 * time.hour) is two hours after t. Layouts for format and parse are Go's, written as the
+reference time 2006-01-02 15:04:05, the module has the common ones.
+*/
+var Time = map[string]Object.Object{
+	"millisecond": &Object.Integer{Value: 1},
+	"second":      &Object.Integer{Value: 1000},
+	"minute":      &Object.Integer{Value: 60 * 1000},
+	"hour":        &Object.Integer{Value: 60 * 60 * 1000},
+	"day":         &Object.Integer{Value: 24 * 60 * 60 * 1000},
+
+	"rfc3339":  &Object.String{Value: gotime.RFC3339},
+	"iso_date": &Object.String{Value: gotime.DateOnly},
+	"datetime": &Object.String{Value: gotime.DateTime},
+	"clock":    &Object.String{Value: gotime.TimeOnly},
+
+	"now":       &Object.Builtin{Fn: now},
+	"unix":      &Object.Builtin{Fn: unix("unix", gotime.Time.Unix)},
+	"unix_ms":   &Object.Builtin{Fn: unix("unix_ms", gotime.Time.UnixMilli)},
+	"from_unix": &Object.Builtin{Fn: fromUnix},
+	"sleep":     &Object.Builtin{HostFn: sleep},
+	"format":    &Object.Builtin{Fn: format},
+	"parse":     &Object.Builtin{Fn: parse},
+	"add":       &Object.Builtin{Fn: add},
+	"add_date":  &Object.Builtin{Fn: addDate},
+	"diff":      &Object.Builtin{Fn: diff},
+	"elapsed":   &Object.Builtin{Fn: elapsed},
+	"fields":    &Object.Builtin{Fn: fields},
+}
+
+func wrongArgs(name string, got int, want string) *Object.Error {
+	return Object.NewBuiltinError("wrong number of arguments for '%s'. got=%d, want=%s", name, got, want)
+}
+
+func instant(name string, arg Object.Object) (gotime.Time, *Object.Error) {
+	t, ok := arg.(*Object.Time)
+	if !ok {
+		return gotime.Time{}, Object.NewBuiltinError("argument to '%s' must be TIME, got %s", name, arg.Type())
+	}
+
+	return t.Value, nil
+}
+
+func integer(name string, arg Object.Object) (int64, *Object.Error) {
+	i, ok := arg.(*Object.Integer)
+	if !ok {
+		return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER, got %s", name, arg.Type())
+	}
+
+	return i.Value, nil
+}
+
+func str(name string, arg Object.Object) (string, *Object.Error) {
+	s, ok := arg.(*Object.String)
+	if !ok {
+		return "", Object.NewBuiltinError("argument to '%s' must be STRING, got %s", name, arg.Type())
+	}
+
+	return s.Value, nil
+}
+
+// A number of milliseconds, integer or float, as a Go duration
+func duration(name string, arg Object.Object) (gotime.Duration, *Object.Error) {
+	var ms float64
+
+	switch arg := arg.(type) {
+	case *Object.Integer:
+		ms = float64(arg.Value)
+	case *Object.Float:
+		ms = arg.Value
+	default:
+		return 0, Object.NewBuiltinError("argument to '%s' must be INTEGER or FLOAT milliseconds, got %s", name, arg.Type())
+	}
+
+	ns := ms * float64(gotime.Millisecond)
+	if gomath.IsNaN(ns) || ns > gomath.MaxInt64 || ns < gomath.MinInt64 {
+		return 0, Object.NewBuiltinError("'%s' duration %s is out of range", name, arg.Inspect())
+	}
+
+	return gotime.Duration(ns), nil
+}
+
+func milliseconds(d gotime.Duration) *Object.Float {
+	return &Object.Float{Value: float64(d) / float64(gotime.Millisecond)}
+}
+
+func now(args ...Object.Object) Object.Object {
+	if len(args) != 0 {
+		return wrongArgs("now", len(args), "0")
+	}
+
+	return &Object.Time{Value: gotime.Now()}
+}
+
+// unix() is the seconds since the epoch now, unix(t) at t. unix_ms does the same in milliseconds
+func unix(name string, fn func(gotime.Time) int64) Object.BuiltInFunction {
+	return func(args ...Object.Object) Object.Object {
+		if len(args) > 1 {
+			return wrongArgs(name, len(args), "0 or 1")
+		}
+
+		t := gotime.Now()
+
+		if len(args) == 1 {
+			var err *Object.Error
+			if t, err = instant(name, args[0]); err != nil {
+				return err
+			}
+		}
+
+		return &Object.Integer{Value: fn(t)}
+	}
+}
+
+// from_unix(seconds) is the local time that many seconds after the epoch
+func fromUnix(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("from_unix", len(args), "1")
+	}
+
+	seconds, err := integer("from_unix", args[0])
+	if err != nil {
+		return err
+	}
+
+	return &Object.Time{Value: gotime.Unix(seconds, 0)}
+}
+
+// sleep(ms) pauses the program, waking up early if it's cancelled
+func sleep(host Object.Host, args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("sleep", len(args), "1")
+	}
+
+	d, err := duration("sleep", args[0])
+	if err != nil {
+		return err
+	}
+
+	if d <= 0 {
+		return nil
+	}
+
+	timer := gotime.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-host.Done():
+	}
+
+	return nil
+}
+
+// format(t) writes t as RFC 3339, format(t, layout) with layout
+func format(args ...Object.Object) Object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("format", len(args), "1 or 2")
+	}
+
+	t, err := instant("format", args[0])
+	if err != nil {
+		return err
+	}
+
+	layout := gotime.RFC3339
+
+	if len(args) == 2 {
+		if layout, err = str("format", args[1]); err != nil {
+			return err
+		}
+	}
+
+	return &Object.String{Value: t.Format(layout)}
+}
+
+// parse(s) reads an RFC 3339 time, parse(s, layout) one written with layout. Times without a zone are UTC
+func parse(args ...Object.Object) Object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("parse", len(args), "1 or 2")
+	}
+
+	s, err := str("parse", args[0])
+	if err != nil {
+		return err
+	}
+
+	layout := gotime.RFC3339
+
+	if len(args) == 2 {
+		if layout, err = str("parse", args[1]); err != nil {
+			return err
+		}
+	}
+
+	t, parseErr := gotime.Parse(layout, s)
+	if parseErr != nil {
+		return Object.NewBuiltinError("parse: %s", parseErr)
+	}
+
+	return &Object.Time{Value: t}
+}
+
+// add(t, ms) is ms milliseconds after t, before it if ms is negative
+func add(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("add", len(args), "2")
+	}
+
+	t, err := instant("add", args[0])
+	if err != nil {
+		return err
+	}
+
+	d, err := duration("add", args[1])
+	if err != nil {
+		return err
+	}
+
+	return &Object.Time{Value: t.Add(d)}
+}
+
+// add_date(t, years, months, days) moves t by calendar units, so a month from January 31st is March 2nd or 3rd
+func addDate(args ...Object.Object) Object.Object {
+	if len(args) != 4 {
+		return wrongArgs("add_date", len(args), "4")
+	}
+
+	t, err := instant("add_date", args[0])
+	if err != nil {
+		return err
+	}
+
+	units := make([]int, 3)
+
+	for i, arg := range args[1:] {
+		n, err := integer("add_date", arg)
+		if err != nil {
+			return err
+		}
+		units[i] = int(n)
+	}
+
+	return &Object.Time{Value: t.AddDate(units[0], units[1], units[2])}
+}
+
+// diff(a, b) is how many milliseconds a is after b
+func diff(args ...Object.Object) Object.Object {
+	if len(args) != 2 {
+		return wrongArgs("diff", len(args), "2")
+	}
+
+	a, err := instant("diff", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := instant("diff", args[1])
+	if err != nil {
+		return err
+	}
+
+	return milliseconds(a.Sub(b))
+}
+
+// elapsed(start) is the milliseconds since start, measured on the monotonic clock when start came from now()
+func elapsed(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("elapsed", len(args), "1")
+	}
+
+	start, err := instant("elapsed", args[0])
+	if err != nil {
+		return err
+	}
+
+	return milliseconds(gotime.Since(start))
+}
+
+// fields(t) is a hash with t's year, month, day, hour, minute, second, nanosecond and weekday, 0 being Sunday
+func fields(args ...Object.Object) Object.Object {
+	if len(args) != 1 {
+		return wrongArgs("fields", len(args), "1")
+	}
+
+	t, err := instant("fields", args[0])
+	if err != nil {
+		return err
+	}
+
+	names := []string{"year", "month", "day", "hour", "minute", "second", "nanosecond", "weekday"}
+	values := []int{t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), int(t.Weekday())}
+
+	result := Object.NewHash()
+
+	for i, name := range names {
+		result.Set(&Object.String{Value: name}, &Object.Integer{Value: int64(values[i])})
+	}
+
+	return result
+}
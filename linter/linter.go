@@ -0,0 +1,555 @@
+package linter
+
+import (
+	"fmt"
+	Ast "github/FabioVV/comp_lang/ast"
+	"github/FabioVV/comp_lang/compiler"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/lib"
+	Object "github/FabioVV/comp_lang/object"
+	Parser "github/FabioVV/comp_lang/parser"
+	Token "github/FabioVV/comp_lang/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The checks the linter runs, a warning always belongs to one of them
+const (
+	UNUSED            = "unused"
+	SHADOW            = "shadow"
+	UNREACHABLE       = "unreachable"
+	UNDECLARED        = "undeclared"
+	DUPLICATEKEY      = "duplicate-key"
+	CONSTANTCONDITION = "constant-condition"
+)
+
+/*
+A comment starting with IGNOREDIRECTIVE silences warnings. At the end of a line it silences that line,
+on a line of its own it silences the line after it. It can be followed by the names of the checks to
+silence, without them every check is silenced:
+
+	var unused = 1 // lint:ignore unused
+*/
+const IGNOREDIRECTIVE = "lint:ignore"
+
+type Warning struct {
+	Check string
+	Object.Warning
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s:%d: %s (%s)", w.Filename, w.Line, w.Message, w.Check)
+}
+
+type binding struct {
+	token Token.Token
+	kind  string // variable, parameter, function, type or module
+	used  bool
+}
+
+// Mirrors the compiler's symbol tables: only functions open a new scope, blocks don't
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+func (s *scope) resolve(name string) (*binding, bool) {
+	for current := s; current != nil; current = current.outer {
+		if b, ok := current.bindings[name]; ok {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+type Linter struct {
+	filename string
+	scope    *scope
+	builtins map[string]bool
+	ignores  map[int][]string // line -> checks silenced on it, empty means all of them
+
+	warnings []*Warning
+}
+
+func New(filename string) *Linter {
+	builtins := make(map[string]bool)
+
+	for _, b := range Object.Builtins {
+		builtins[b.Name] = true
+	}
+
+	return &Linter{
+		filename: filename,
+		scope:    newScope(nil),
+		builtins: builtins,
+		ignores:  make(map[int][]string),
+	}
+}
+
+// Lints a program the parser had no errors with, returning the warnings that weren't silenced sorted by line
+func (l *Linter) Lint(program *Ast.Program) []*Warning {
+	l.statements(program.Statements, true)
+	l.closeScope()
+
+	warnings := []*Warning{}
+
+	for _, w := range l.warnings {
+		if !l.ignored(w) {
+			warnings = append(warnings, w)
+		}
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		return warnings[i].Line < warnings[j].Line
+	})
+
+	return warnings
+}
+
+// Parses and lints the file at path. Parser errors are returned as they are, nothing gets linted then
+func LintFile(path string) ([]*Warning, []*Object.Error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	p := Parser.New(Lexer.New(file, path))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, p.Errors(), nil
+	}
+
+	return New(path).Lint(program), nil, nil
+}
+
+func (l *Linter) warn(check string, tok Token.Token, format string, a ...interface{}) {
+	filename := tok.Filename
+	if filename == "" {
+		filename = l.filename
+	}
+
+	l.warnings = append(l.warnings, &Warning{
+		Check: check,
+		Warning: Object.Warning{
+			Message:  fmt.Sprintf(format, a...),
+			Filename: filename,
+			Line:     tok.Pos.Line,
+			Column:   tok.Pos.Column,
+		},
+	})
+}
+
+func (l *Linter) ignored(w *Warning) bool {
+	checks, ok := l.ignores[w.Line]
+	if !ok {
+		return false
+	}
+
+	if len(checks) == 0 {
+		return true
+	}
+
+	for _, check := range checks {
+		if check == w.Check {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Linter) directive(c *Ast.Comment, trailing bool) {
+	text := strings.TrimSpace(c.Value)
+
+	if !strings.HasPrefix(text, IGNOREDIRECTIVE) {
+		return
+	}
+
+	line := c.Token.Pos.Line
+	if !trailing {
+		line++
+	}
+
+	checks := strings.Fields(strings.TrimPrefix(text, IGNOREDIRECTIVE))
+
+	// A bare lint:ignore silences everything on the line, whatever other directives there name
+	if existing, ok := l.ignores[line]; ok && (len(existing) == 0 || len(checks) == 0) {
+		l.ignores[line] = []string{}
+		return
+	}
+
+	l.ignores[line] = append(l.ignores[line], checks...)
+}
+
+func (l *Linter) openScope() {
+	l.scope = newScope(l.scope)
+}
+
+// Leaves a function's scope or, at the end of the program, the top level. Everything declared in it that was never read is reported
+func (l *Linter) closeScope() {
+	names := make([]string, 0, len(l.scope.bindings))
+
+	for name := range l.scope.bindings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		l.reportUnused(name, l.scope.bindings[name])
+	}
+
+	l.scope = l.scope.outer
+}
+
+func (l *Linter) reportUnused(name string, b *binding) {
+	if b.used || b.kind == "type" || strings.HasPrefix(name, "_") {
+		return
+	}
+
+	// Top level functions are what a file gives the files that #load it, and a test file's tests
+	if l.scope.outer == nil && b.kind == "function" {
+		return
+	}
+
+	l.warn(UNUSED, b.token, "%s '%s' is declared but never used", b.kind, name)
+}
+
+// Declares a name in the current scope, warning if it hides something declared outside of it
+func (l *Linter) declare(ident *Ast.Identifier, kind string) {
+	name := ident.Value
+
+	if name == "_" {
+		return
+	}
+
+	// Redeclaring a name in the same scope replaces it, so the old one can't be read anymore
+	if old, ok := l.scope.bindings[name]; ok {
+		l.reportUnused(name, old)
+
+	} else if outer, ok := l.scope.resolve(name); ok {
+		l.warn(SHADOW, ident.Token, "%s '%s' shadows the %s declared on line %d", kind, name, outer.kind, outer.token.Pos.Line)
+
+	} else if l.builtins[name] {
+		l.warn(SHADOW, ident.Token, "%s '%s' shadows the builtin function %s", kind, name, name)
+	}
+
+	l.scope.bindings[name] = &binding{token: ident.Token, kind: kind}
+}
+
+func (l *Linter) use(name string) {
+	if b, ok := l.scope.resolve(name); ok {
+		b.used = true
+	}
+}
+
+// Checks the target of an assignment exists. Assigning doesn't count as using a variable, updating it does
+func (l *Linter) assign(ident *Ast.Identifier, reads bool) {
+	b, ok := l.scope.resolve(ident.Value)
+
+	if !ok {
+		if !l.builtins[ident.Value] {
+			l.warn(UNDECLARED, ident.Token, "assignment to undeclared variable '%s'", ident.Value)
+		}
+		return
+	}
+
+	if reads {
+		b.used = true
+	}
+}
+
+func (l *Linter) statements(stmts []Ast.Statement, topLevel bool) {
+	terminated, reported := false, false
+
+	for i, s := range stmts {
+		if es, ok := s.(*Ast.ExpressionStatement); ok {
+			switch c := es.Expression.(type) {
+			case *Ast.Comment:
+				l.directive(c, c.Token.Newlines == 0 && !(topLevel && i == 0))
+				continue
+
+			case *Ast.MultiLineComment:
+				continue
+			}
+		}
+
+		if terminated && !reported {
+			l.warn(UNREACHABLE, statementToken(s), "unreachable code")
+			reported = true
+		}
+
+		l.statement(s)
+
+		switch s.(type) {
+		case *Ast.ReturnStatement, *Ast.BreakStatement, *Ast.ContinueStatement:
+			terminated = true
+		}
+	}
+}
+
+func (l *Linter) statement(s Ast.Statement) {
+	switch s := s.(type) {
+	case *Ast.VarStatement:
+		l.expression(s.Value)
+		l.declare(s.Name, "variable")
+
+	case *Ast.FunctionStatement:
+		// Declared before the body so it can call itself, like the compiler does
+		l.declare(s.Name, "function")
+		l.function(s.Parameters, s.Body, "")
+
+	case *Ast.ReturnStatement:
+		l.expression(s.ReturnValue)
+
+	case *Ast.ExpressionStatement:
+		l.expression(s.Expression)
+
+	case *Ast.BlockStatement:
+		l.statements(s.Statements, false)
+	}
+}
+
+func (l *Linter) block(b *Ast.BlockStatement) {
+	if b != nil {
+		l.statements(b.Statements, false)
+	}
+}
+
+func (l *Linter) function(params []*Ast.Identifier, body *Ast.BlockStatement, name string) {
+	l.openScope()
+
+	// A function literal assigned to a variable can refer to itself by that name
+	if name != "" {
+		l.scope.bindings[name] = &binding{kind: "function", used: true}
+	}
+
+	for _, param := range params {
+		l.declare(param, "parameter")
+	}
+
+	l.block(body)
+	l.closeScope()
+}
+
+func (l *Linter) expression(e Ast.Expression) {
+	switch e := e.(type) {
+	case *Ast.Identifier:
+		l.use(e.Value)
+
+	case *Ast.PrefixExpression:
+		l.expression(e.Right)
+
+	case *Ast.InfixExpression:
+		l.expression(e.Left)
+
+		// The right side of a . is a field name, not a variable
+		if e.Token.Type != Token.PERIOD {
+			l.expression(e.Right)
+		}
+
+	case *Ast.CallExpression:
+		l.expression(e.Function)
+		l.expressions(e.Arguments)
+
+	case *Ast.IndexExpression:
+		l.expression(e.Left)
+		l.expression(e.Index)
+
+	case *Ast.ArrayLiteral:
+		l.expressions(e.Elements)
+
+	case *Ast.HashLiteral:
+		l.hashLiteral(e)
+
+	case *Ast.FunctionLiteral:
+		l.function(e.Parameters, e.Body, e.Name)
+
+	case *Ast.IFexpression:
+		if isConstant(e.Condition) {
+			l.warn(CONSTANTCONDITION, e.Token, "if condition is constant, only one of its branches can ever run")
+		}
+
+		l.expression(e.Condition)
+		l.block(e.Consequence)
+		l.block(e.Alternative)
+
+	case *Ast.FORexpression:
+		if e.LoopVariable != nil {
+			l.expression(e.LoopVariable.Value)
+			l.declare(e.LoopVariable.Name, "variable")
+		}
+
+		l.expression(e.LoopCondition)
+		l.expression(e.LoopStep)
+		l.block(e.Body)
+
+	case *Ast.LoopExpression:
+		l.block(e.Body)
+
+	case *Ast.AssignExpression:
+		l.expression(e.Value)
+		l.assign(e.Left, false)
+
+	case *Ast.CompoundAssignExpression:
+		l.expression(e.Value)
+		l.assign(e.Left, true)
+
+	case *Ast.IncDecExpression:
+		l.assign(e.Identifier, true)
+
+	case *Ast.AssignIndexExpression:
+		l.expression(e.Left)
+		l.expression(e.Index)
+		l.expression(e.Value)
+
+	case *Ast.TypeDef:
+		for _, key := range e.Keys {
+			l.expression(e.Pairs[key])
+		}
+
+		l.declare(e.Name, "type")
+
+	case *Ast.TypeDefStatement:
+		l.use(e.Token.Literal)
+		l.expression(e.Value)
+		l.declare(e.Name, "variable")
+
+	case *Ast.LoadExpression:
+		l.load(e)
+	}
+}
+
+func (l *Linter) expressions(list []Ast.Expression) {
+	for _, e := range list {
+		l.expression(e)
+	}
+}
+
+func (l *Linter) hashLiteral(h *Ast.HashLiteral) {
+	seen := make(map[string]bool)
+
+	for _, key := range h.Keys {
+		if id, tok, ok := literalKey(key); ok {
+			if seen[id] {
+				l.warn(DUPLICATEKEY, tok, "duplicate key %s in hash literal", describeKey(key))
+			}
+
+			seen[id] = true
+		}
+
+		l.expression(key)
+		l.expression(h.Pairs[key])
+	}
+}
+
+/*
+The names a #load brings in are declared as used, the linter can't know what other files use from it.
+Only the loaded file's top level declarations are looked at, it gets linted on its own.
+*/
+func (l *Linter) load(e *Ast.LoadExpression) {
+	lit, ok := e.File.(*Ast.StringLiteral)
+	if !ok {
+		return
+	}
+
+	// A native module binds a variable named after it
+	if lib.Exists(lit.Value) {
+		l.declare(&Ast.Identifier{Token: e.Token, Value: lit.Value}, "module")
+		return
+	}
+
+	if !strings.HasSuffix(lit.Value, ".momo") {
+		return
+	}
+
+	file, err := os.Open(compiler.ResolveLoadPath(l.filename, lit.Value))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	p := Parser.New(Lexer.New(file, filepath.Base(lit.Value)))
+	program := p.ParseProgram()
+
+	for _, s := range program.Statements {
+		switch s := s.(type) {
+		case *Ast.VarStatement:
+			l.scope.bindings[s.Name.Value] = &binding{token: s.Name.Token, kind: "variable", used: true}
+
+		case *Ast.FunctionStatement:
+			l.scope.bindings[s.Name.Value] = &binding{token: s.Name.Token, kind: "function", used: true}
+		}
+	}
+}
+
+// A condition made only of literals always evaluates to the same thing
+func isConstant(e Ast.Expression) bool {
+	switch e := e.(type) {
+	case *Ast.IntegerLiteral, *Ast.FloatLiteral, *Ast.StringLiteral, *Ast.Boolean,
+		*Ast.ArrayLiteral, *Ast.HashLiteral, *Ast.FunctionLiteral:
+		return true
+
+	case *Ast.PrefixExpression:
+		return isConstant(e.Right)
+
+	case *Ast.InfixExpression:
+		return e.Token.Type != Token.PERIOD && isConstant(e.Left) && isConstant(e.Right)
+	}
+
+	return false
+}
+
+// Identifies hash keys whose value is known without running the program
+func literalKey(e Ast.Expression) (string, Token.Token, bool) {
+	switch e := e.(type) {
+	case *Ast.StringLiteral:
+		return "string:" + e.Value, e.Token, true
+
+	case *Ast.IntegerLiteral:
+		return fmt.Sprintf("int:%d", e.Value), e.Token, true
+
+	case *Ast.Boolean:
+		return fmt.Sprintf("bool:%t", e.Value), e.Token, true
+	}
+
+	return "", Token.Token{}, false
+}
+
+func describeKey(e Ast.Expression) string {
+	if s, ok := e.(*Ast.StringLiteral); ok {
+		return "\"" + s.Value + "\""
+	}
+
+	return e.String()
+}
+
+func statementToken(s Ast.Statement) Token.Token {
+	switch s := s.(type) {
+	case *Ast.VarStatement:
+		return s.Token
+	case *Ast.FunctionStatement:
+		return s.Token
+	case *Ast.ReturnStatement:
+		return s.Token
+	case *Ast.BreakStatement:
+		return s.Token
+	case *Ast.ContinueStatement:
+		return s.Token
+	case *Ast.ExpressionStatement:
+		return s.Token
+	case *Ast.BlockStatement:
+		return s.Token
+	}
+
+	return Token.Token{}
+}
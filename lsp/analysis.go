@@ -0,0 +1,512 @@
+package lsp
+
+import (
+	Ast "github/FabioVV/comp_lang/ast"
+	"github/FabioVV/comp_lang/compiler"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/lib"
+	Object "github/FabioVV/comp_lang/object"
+	Parser "github/FabioVV/comp_lang/parser"
+	Token "github/FabioVV/comp_lang/token"
+	"os"
+	"strings"
+)
+
+// Something a name can refer to
+type definition struct {
+	name      string
+	kind      string // variable, parameter, function, type or builtin
+	valueType string // object type of the value when it can be told from the source, empty otherwise
+	detail    string
+	filename  string
+	line      int
+	column    int
+	endLine   int // Functions only, line of the closing brace
+	scope     *scope
+
+	children []*definition // What a function declares, for document symbols
+}
+
+// A name written somewhere in the document and what it refers to, nil if it couldn't be resolved
+type occurrence struct {
+	name string
+	line int
+	def  *definition
+	from *scope
+}
+
+// Same scoping rules as the compiler's symbol tables: the global scope and one per function
+type scope struct {
+	outer *scope
+	defs  map[string]*definition
+	start int
+	end   int
+}
+
+type load struct {
+	line int
+	path string
+}
+
+// What the server knows about a document, rebuilt from scratch whenever it changes
+type index struct {
+	filename string
+	lines    []string
+
+	global      *scope
+	current     *scope
+	scopes      []*scope
+	enclosing   *definition // The function whose body is being walked
+	symbols     []*definition
+	occurrences []*occurrence
+	loads       []*load
+	loaded      map[string]bool
+}
+
+func newScope(outer *scope, start int, end int) *scope {
+	return &scope{outer: outer, defs: make(map[string]*definition), start: start, end: end}
+}
+
+func (s *scope) resolve(name string) (*definition, bool) {
+	for current := s; current != nil; current = current.outer {
+		if def, ok := current.defs[name]; ok {
+			return def, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+Walks a program the way the compiler would, recording every declaration and every use of a name.
+A program with parser errors has holes in it, whatever was indexed before the walk hit one is kept.
+*/
+func analyze(program *Ast.Program, filename string, lines []string) (ix *index) {
+	ix = &index{filename: filename, lines: lines, loaded: make(map[string]bool)}
+	ix.global = newScope(nil, 1, len(lines))
+	ix.current = ix.global
+
+	for _, b := range Object.Builtins {
+		ix.global.defs[b.Name] = &definition{name: b.Name, kind: "builtin", valueType: Object.BUILTIN_OBJ, scope: ix.global}
+	}
+
+	defer func() {
+		recover()
+	}()
+
+	ix.statements(program.Statements)
+	return ix
+}
+
+// How a definition is reached from a scope, in the compiler's terms
+func scopeName(def *definition, from *scope) compiler.SymbolScope {
+	switch {
+	case def.kind == "builtin":
+		return compiler.BUILTINSCOPE
+	case def.scope.outer == nil:
+		return compiler.GLOBALSCOPE
+	case def.scope == from:
+		return compiler.LOCALSCOPE
+	}
+
+	return compiler.FREESCOPE
+}
+
+func (ix *index) declare(ident *Ast.Identifier, kind string, valueType string, detail string) *definition {
+	def := &definition{
+		name:      ident.Value,
+		kind:      kind,
+		valueType: valueType,
+		detail:    detail,
+		filename:  ident.Token.Filename,
+		line:      ident.Token.Pos.Line,
+		column:    ident.Token.Pos.Column,
+		scope:     ix.current,
+	}
+
+	ix.current.defs[ident.Value] = def
+	ix.occurrences = append(ix.occurrences, &occurrence{name: ident.Value, line: def.line, def: def, from: ix.current})
+
+	if ix.enclosing != nil {
+		ix.enclosing.children = append(ix.enclosing.children, def)
+	} else {
+		ix.symbols = append(ix.symbols, def)
+	}
+
+	return def
+}
+
+func (ix *index) use(ident *Ast.Identifier) {
+	def, _ := ix.current.resolve(ident.Value)
+	ix.occurrences = append(ix.occurrences, &occurrence{name: ident.Value, line: ident.Token.Pos.Line, def: def, from: ix.current})
+}
+
+func (ix *index) statements(stmts []Ast.Statement) {
+	for _, s := range stmts {
+		ix.statement(s)
+	}
+}
+
+func (ix *index) statement(s Ast.Statement) {
+	switch s := s.(type) {
+	case *Ast.VarStatement:
+		// A function assigned to a variable is a named function, its body can already see the name
+		if fl, ok := s.Value.(*Ast.FunctionLiteral); ok {
+			def := ix.declare(s.Name, "function", Object.FUNCTION_OBJ, signature(s.Name.Value, fl.Parameters))
+			ix.function(def, fl.Token, fl.Parameters, fl.Body)
+			return
+		}
+
+		ix.expression(s.Value)
+		ix.declare(s.Name, "variable", ix.typeOf(s.Value), "var "+s.Name.Value)
+
+	case *Ast.FunctionStatement:
+		def := ix.declare(s.Name, "function", Object.FUNCTION_OBJ, signature(s.Name.Value, s.Parameters))
+		ix.function(def, s.Token, s.Parameters, s.Body)
+
+	case *Ast.ReturnStatement:
+		ix.expression(s.ReturnValue)
+
+	case *Ast.ExpressionStatement:
+		ix.expression(s.Expression)
+
+	case *Ast.BlockStatement:
+		ix.statements(s.Statements)
+	}
+}
+
+func signature(name string, params []*Ast.Identifier) string {
+	names := []string{}
+
+	for _, p := range params {
+		names = append(names, p.Value)
+	}
+
+	return "fn " + name + "(" + strings.Join(names, ", ") + ")"
+}
+
+// Walks a function body in a scope of its own. def is nil for anonymous functions
+func (ix *index) function(def *definition, fnToken Token.Token, params []*Ast.Identifier, body *Ast.BlockStatement) {
+	start := fnToken.Pos.Line
+	end := blockEnd(ix.lines, start, nameRange(ix.lines, start, fnToken.Pos.Column, "fn").Start.Character)
+
+	outerScope, outerFunction := ix.current, ix.enclosing
+
+	ix.current = newScope(ix.current, start, end)
+	ix.scopes = append(ix.scopes, ix.current)
+
+	if def != nil {
+		def.endLine = end
+		ix.enclosing = def
+	}
+
+	for _, p := range params {
+		ix.declare(p, "parameter", "", p.Value)
+	}
+
+	if body != nil {
+		ix.statements(body.Statements)
+	}
+
+	ix.current, ix.enclosing = outerScope, outerFunction
+}
+
+func (ix *index) expression(e Ast.Expression) {
+	switch e := e.(type) {
+	case *Ast.Identifier:
+		ix.use(e)
+
+	case *Ast.PrefixExpression:
+		ix.expression(e.Right)
+
+	case *Ast.InfixExpression:
+		ix.expression(e.Left)
+
+		if e.Token.Type != Token.PERIOD {
+			ix.expression(e.Right)
+		}
+
+	case *Ast.CallExpression:
+		ix.expression(e.Function)
+		ix.expressions(e.Arguments)
+
+	case *Ast.IndexExpression:
+		ix.expression(e.Left)
+		ix.expression(e.Index)
+
+	case *Ast.ArrayLiteral:
+		ix.expressions(e.Elements)
+
+	case *Ast.HashLiteral:
+		for _, key := range e.Keys {
+			ix.expression(key)
+			ix.expression(e.Pairs[key])
+		}
+
+	case *Ast.FunctionLiteral:
+		ix.function(nil, e.Token, e.Parameters, e.Body)
+
+	case *Ast.IFexpression:
+		ix.expression(e.Condition)
+		ix.block(e.Consequence)
+		ix.block(e.Alternative)
+
+	case *Ast.FORexpression:
+		if e.LoopVariable != nil {
+			ix.statement(e.LoopVariable)
+		}
+
+		ix.expression(e.LoopCondition)
+		ix.expression(e.LoopStep)
+		ix.block(e.Body)
+
+	case *Ast.LoopExpression:
+		ix.block(e.Body)
+
+	case *Ast.AssignExpression:
+		ix.use(e.Left)
+		ix.expression(e.Value)
+
+	case *Ast.CompoundAssignExpression:
+		ix.use(e.Left)
+		ix.expression(e.Value)
+
+	case *Ast.IncDecExpression:
+		ix.use(e.Identifier)
+
+	case *Ast.AssignIndexExpression:
+		ix.expression(e.Left)
+		ix.expression(e.Index)
+		ix.expression(e.Value)
+
+	case *Ast.TypeDef:
+		for _, key := range e.Keys {
+			ix.expression(e.Pairs[key])
+		}
+
+		ix.declare(e.Name, "type", Object.TYPE_DEF_OBJ, "typedef "+e.Name.Value)
+
+	case *Ast.TypeDefStatement:
+		ix.use(&Ast.Identifier{Token: e.Token, Value: e.Token.Literal})
+		ix.expression(e.Value)
+		ix.declare(e.Name, "variable", e.Token.Literal, e.Token.Literal+" "+e.Name.Value)
+
+	case *Ast.LoadExpression:
+		ix.load(e)
+	}
+}
+
+func (ix *index) expressions(list []Ast.Expression) {
+	for _, e := range list {
+		ix.expression(e)
+	}
+}
+
+func (ix *index) block(b *Ast.BlockStatement) {
+	if b != nil {
+		ix.statements(b.Statements)
+	}
+}
+
+// Declares the top level names of a #loaded file, pointing at where they are in that file
+func (ix *index) load(e *Ast.LoadExpression) {
+	lit, ok := e.File.(*Ast.StringLiteral)
+	if !ok {
+		return
+	}
+
+	// A native module is a hash bound to a variable named after it
+	if lib.Exists(lit.Value) {
+		ix.declare(&Ast.Identifier{Token: e.Token, Value: lit.Value}, "module", Object.HASH_OBJ, "#load \""+lit.Value+"\"")
+		return
+	}
+
+	if !strings.HasSuffix(lit.Value, ".momo") {
+		return
+	}
+
+	path := compiler.ResolveLoadPath(e.Token.Filename, lit.Value)
+
+	if e.Token.Filename == ix.filename {
+		ix.loads = append(ix.loads, &load{line: e.Token.Pos.Line, path: path})
+	}
+
+	if ix.loaded[path] {
+		return
+	}
+	ix.loaded[path] = true
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	program := Parser.New(Lexer.New(file, path)).ParseProgram()
+
+	for _, s := range program.Statements {
+		switch s := s.(type) {
+		case *Ast.VarStatement:
+			ix.global.defs[s.Name.Value] = ix.loadedDefinition(s.Name, "variable", ix.typeOf(s.Value), "var "+s.Name.Value)
+
+		case *Ast.FunctionStatement:
+			ix.global.defs[s.Name.Value] = ix.loadedDefinition(s.Name, "function", Object.FUNCTION_OBJ, signature(s.Name.Value, s.Parameters))
+
+		case *Ast.ExpressionStatement:
+			if nested, ok := s.Expression.(*Ast.LoadExpression); ok {
+				ix.load(nested)
+			}
+		}
+	}
+}
+
+func (ix *index) loadedDefinition(ident *Ast.Identifier, kind string, valueType string, detail string) *definition {
+	return &definition{
+		name:      ident.Value,
+		kind:      kind,
+		valueType: valueType,
+		detail:    detail,
+		filename:  ident.Token.Filename,
+		line:      ident.Token.Pos.Line,
+		column:    ident.Token.Pos.Column,
+		scope:     ix.global,
+	}
+}
+
+// The object type an expression evaluates to, as far as it can be told without running it
+func (ix *index) typeOf(e Ast.Expression) string {
+	switch e := e.(type) {
+	case *Ast.IntegerLiteral:
+		return Object.INTEGER_OBJ
+	case *Ast.FloatLiteral:
+		return Object.FLOAT_OBJ
+	case *Ast.StringLiteral:
+		return Object.STRING_OBJ
+	case *Ast.Boolean:
+		return Object.BOOLEAN_OBJ
+	case *Ast.ArrayLiteral:
+		return Object.ARRAY_OBJ
+	case *Ast.HashLiteral:
+		return Object.HASH_OBJ
+	case *Ast.FunctionLiteral:
+		return Object.FUNCTION_OBJ
+	case *Ast.TypeDef:
+		return Object.TYPE_DEF_OBJ
+
+	case *Ast.Identifier:
+		if def, ok := ix.current.resolve(e.Value); ok {
+			return def.valueType
+		}
+
+	case *Ast.PrefixExpression:
+		if e.Operator == "!" {
+			return Object.BOOLEAN_OBJ
+		}
+		return ix.typeOf(e.Right)
+
+	case *Ast.InfixExpression:
+		switch e.Token.Type {
+		case Token.EQ, Token.NOT_EQ, Token.LT, Token.GT, Token.LT_OR_EQ, Token.GT_OR_EQ, Token.AND, Token.OR:
+			return Object.BOOLEAN_OBJ
+
+		case Token.PLUS, Token.MINUS, Token.ASTERISK, Token.SLASH, Token.MODULUS:
+			left, right := ix.typeOf(e.Left), ix.typeOf(e.Right)
+
+			if left == right {
+				return left
+			}
+		}
+	}
+
+	return ""
+}
+
+/*
+Line of the brace closing the first block that opens on line start at or after column, found by
+counting braces outside of strings and comments. It's the end of the document if it's never closed.
+*/
+func blockEnd(lines []string, start int, column int) int {
+	depth := 0
+	inString, inComment := false, false
+
+	for l := start - 1; l >= 0 && l < len(lines); l++ {
+		text := []rune(lines[l])
+
+		i := 0
+		if l == start-1 {
+			i = column
+		}
+
+		for ; i < len(text); i++ {
+			r := text[i]
+
+			switch {
+			case inComment:
+				if r == '*' && i+1 < len(text) && text[i+1] == '/' {
+					inComment = false
+					i++
+				}
+
+			case inString:
+				if r == '"' {
+					inString = false
+				}
+
+			case r == '"':
+				inString = true
+
+			case r == '/' && i+1 < len(text) && text[i+1] == '/':
+				i = len(text)
+
+			case r == '/' && i+1 < len(text) && text[i+1] == '*':
+				inComment = true
+				i++
+
+			case r == '{':
+				depth++
+
+			case r == '}':
+				depth--
+
+				if depth == 0 {
+					return l + 1
+				}
+			}
+		}
+	}
+
+	return len(lines)
+}
+
+// The definition of the name written at pos, if it is one the index knows about
+func (ix *index) definitionAt(pos Position) (*definition, *scope, bool) {
+	name := wordAt(ix.lines, pos)
+	if name == "" {
+		return nil, nil, false
+	}
+
+	for _, o := range ix.occurrences {
+		if o.name == name && o.line == pos.Line+1 && o.def != nil {
+			return o.def, o.from, true
+		}
+	}
+
+	if def, ok := ix.global.defs[name]; ok && def.kind == "builtin" {
+		return def, ix.global, true
+	}
+
+	return nil, nil, false
+}
+
+// The innermost scope a 1 based line is in
+func (ix *index) scopeAt(line int) *scope {
+	found := ix.global
+
+	for _, s := range ix.scopes {
+		if s.start <= line && line <= s.end && s.start >= found.start {
+			found = s
+		}
+	}
+
+	return found
+}
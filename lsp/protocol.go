@@ -0,0 +1,222 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// The parts of the LSP spec the server uses. Lines and characters are 0 based, unlike token positions
+
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type TextDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   TextDocumentIdentifier           `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type DocumentSymbolParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+	SEVERITYERROR   = 1
+	SEVERITYWARNING = 2
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// SymbolKind and CompletionItemKind values from the spec
+const (
+	SYMBOLFUNCTION = 12
+	SYMBOLVARIABLE = 13
+	SYMBOLSTRUCT   = 23
+
+	COMPLETIONFUNCTION = 3
+	COMPLETIONVARIABLE = 6
+	COMPLETIONKEYWORD  = 14
+	COMPLETIONSTRUCT   = 22
+)
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
+
+// The whole of a 1 based source line, for when only the line of something is known
+func lineRange(lines []string, line int) Range {
+	l := line - 1
+	if l < 0 {
+		l = 0
+	}
+
+	length := 0
+	if l < len(lines) {
+		length = len([]rune(lines[l]))
+	}
+
+	return Range{Start: Position{Line: l}, End: Position{Line: l, Character: length}}
+}
+
+/*
+Where name is on a 1 based source line. Token columns point somewhere around the end of a token, so the
+occurrence of name closest to column is the one the token came from.
+*/
+func nameRange(lines []string, line int, column int, name string) Range {
+	l := line - 1
+	if l < 0 || l >= len(lines) {
+		return lineRange(lines, line)
+	}
+
+	text := []rune(lines[l])
+	target := []rune(name)
+	best := -1
+
+	for i := 0; i+len(target) <= len(text); i++ {
+		if string(text[i:i+len(target)]) != name {
+			continue
+		}
+
+		if i > 0 && isIdentRune(text[i-1]) || i+len(target) < len(text) && isIdentRune(text[i+len(target)]) {
+			continue
+		}
+
+		if best < 0 || abs(i-column) < abs(best-column) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return lineRange(lines, line)
+	}
+
+	return Range{Start: Position{Line: l, Character: best}, End: Position{Line: l, Character: best + len(target)}}
+}
+
+// The identifier the cursor is on, or right after
+func wordAt(lines []string, pos Position) string {
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return ""
+	}
+
+	text := []rune(lines[pos.Line])
+
+	start := pos.Character
+	if start > len(text) {
+		start = len(text)
+	}
+
+	end := start
+
+	for start > 0 && isIdentRune(text[start-1]) {
+		start--
+	}
+
+	for end < len(text) && isIdentRune(text[end]) {
+		end++
+	}
+
+	return string(text[start:end])
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r > 127
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
@@ -0,0 +1,391 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github/FabioVV/comp_lang/compiler"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/linter"
+	Parser "github/FabioVV/comp_lang/parser"
+	Token "github/FabioVV/comp_lang/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const SERVERNAME = "momo-lsp"
+
+/*
+Server is a language server speaking LSP over a pair of streams, stdin and stdout for editors.
+Documents are synced whole on every change and re-analyzed from scratch, momo files are small.
+*/
+type Server struct {
+	t         *transport
+	documents map[string]string // uri -> text
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{t: newTransport(in, out), documents: make(map[string]string)}
+}
+
+// Serves requests until the client sends exit or closes the input
+func (s *Server) Run() error {
+	for {
+		req, err := s.t.read()
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		// Only broken framing or I/O ends the server, a bad body gets an error response
+		var bad *badMessage
+		if errors.As(err, &bad) {
+			if err := s.t.write(&errorResponse{JSONRPC: "2.0", ID: bad.id, Error: bad.err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit requested before shutdown")
+			}
+			return nil
+		}
+
+		result, rpcErr := s.handle(req)
+
+		// Notifications don't get an answer
+		if req.ID == nil {
+			continue
+		}
+
+		if rpcErr != nil {
+			err = s.t.write(&errorResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr})
+		} else {
+			err = s.t.write(&response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // Full
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": SERVERNAME},
+		}, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+		s.publishDiagnostics(params.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+
+		s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+		s.publishDiagnostics(params.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		delete(s.documents, params.TextDocument.URI)
+		s.t.write(&notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}},
+		})
+		return nil, nil
+
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		return s.hover(params), nil
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		return s.definition(params), nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		return s.documentSymbols(params.TextDocument.URI), nil
+
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		return s.completion(params), nil
+
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil, nil
+	}
+
+	return nil, &responseError{Code: METHODNOTFOUND, Message: fmt.Sprintf("method %s is not supported", req.Method)}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: INVALIDPARAMS, Message: err.Error()}
+}
+
+// Parses and indexes an open document
+func (s *Server) analyze(uri string) *index {
+	text := s.documents[uri]
+	path := uriToPath(uri)
+
+	program := Parser.New(Lexer.New(strings.NewReader(text), path)).ParseProgram()
+
+	return analyze(program, path, splitLines(text))
+}
+
+/*
+Diagnostics are the parser's errors or, if it had none, the compiler's error and warnings plus the
+linter's warnings. Problems in a #loaded file are shown on the document's first line.
+*/
+func (s *Server) diagnostics(uri string) []Diagnostic {
+	text := s.documents[uri]
+	path := uriToPath(uri)
+	lines := splitLines(text)
+
+	diagnostics := []Diagnostic{}
+
+	add := func(severity int, source string, filename string, line int, message string) {
+		if filename != "" && filename != path {
+			message = filepath.Base(filename) + ": " + message
+			line = 1
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{Range: lineRange(lines, line), Severity: severity, Source: source, Message: message})
+	}
+
+	p := Parser.New(Lexer.New(strings.NewReader(text), path))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Errors() {
+			add(SEVERITYERROR, "parser", err.Filename, err.Line, err.Message)
+		}
+
+		return diagnostics
+	}
+
+	comp := compiler.New()
+
+	if err := comp.Compile(program); err != nil {
+		add(SEVERITYERROR, "compiler", err.Filename, err.Line, err.Message)
+	}
+
+	for _, w := range comp.Warnings() {
+		add(SEVERITYWARNING, "compiler", w.Filename, w.Line, w.Message)
+	}
+
+	for _, w := range linter.New(path).Lint(program) {
+		add(SEVERITYWARNING, "lint", w.Filename, w.Line, w.Message+" ("+w.Check+")")
+	}
+
+	return diagnostics
+}
+
+func (s *Server) publishDiagnostics(uri string) {
+	s.t.write(&notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: s.diagnostics(uri)},
+	})
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	ix := s.analyze(params.TextDocument.URI)
+
+	def, from, ok := ix.definitionAt(params.Position)
+	if !ok {
+		return nil
+	}
+
+	var out strings.Builder
+
+	out.WriteString("```momo\n")
+	if def.detail != "" {
+		out.WriteString(def.detail)
+	} else {
+		out.WriteString(def.name)
+	}
+	out.WriteString("\n```\n")
+
+	fmt.Fprintf(&out, "%s %s", strings.ToLower(string(scopeName(def, from))), def.kind)
+
+	if def.valueType != "" {
+		fmt.Fprintf(&out, ", type %s", def.valueType)
+	}
+
+	if def.line > 0 {
+		fmt.Fprintf(&out, ", declared at %s:%d", filepath.Base(def.filename), def.line)
+	}
+
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: out.String()}}
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) []Location {
+	ix := s.analyze(params.TextDocument.URI)
+
+	// On a #load line the file being loaded is the definition
+	for _, l := range ix.loads {
+		if l.line == params.Position.Line+1 {
+			if _, err := os.Stat(l.path); err == nil {
+				return []Location{{URI: pathToURI(l.path)}}
+			}
+		}
+	}
+
+	def, _, ok := ix.definitionAt(params.Position)
+	if !ok || def.line == 0 {
+		return []Location{}
+	}
+
+	lines := ix.lines
+
+	if def.filename != ix.filename {
+		src, err := os.ReadFile(def.filename)
+		if err != nil {
+			return []Location{}
+		}
+
+		lines = splitLines(string(src))
+	}
+
+	return []Location{{URI: pathToURI(def.filename), Range: nameRange(lines, def.line, def.column, def.name)}}
+}
+
+func (s *Server) documentSymbols(uri string) []DocumentSymbol {
+	ix := s.analyze(uri)
+	return documentSymbols(ix, ix.symbols)
+}
+
+func documentSymbols(ix *index, defs []*definition) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, def := range defs {
+		if def.kind == "parameter" {
+			continue
+		}
+
+		selection := nameRange(ix.lines, def.line, def.column, def.name)
+
+		symbol := DocumentSymbol{
+			Name:           def.name,
+			Detail:         def.detail,
+			Kind:           SYMBOLVARIABLE,
+			Range:          lineRange(ix.lines, def.line),
+			SelectionRange: selection,
+		}
+
+		switch def.kind {
+		case "function":
+			symbol.Kind = SYMBOLFUNCTION
+			symbol.Range = Range{Start: lineRange(ix.lines, def.line).Start, End: lineRange(ix.lines, def.endLine).End}
+			symbol.Children = documentSymbols(ix, def.children)
+
+		case "type":
+			symbol.Kind = SYMBOLSTRUCT
+		}
+
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+// Every name visible where the cursor is, the builtins and the keywords
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+	ix := s.analyze(params.TextDocument.URI)
+
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+
+	for sc := ix.scopeAt(params.Position.Line + 1); sc != nil; sc = sc.outer {
+		names := make([]string, 0, len(sc.defs))
+
+		for name := range sc.defs {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			def := sc.defs[name]
+
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			kind := COMPLETIONVARIABLE
+
+			switch def.kind {
+			case "function", "builtin":
+				kind = COMPLETIONFUNCTION
+			case "type":
+				kind = COMPLETIONSTRUCT
+			}
+
+			items = append(items, CompletionItem{Label: name, Kind: kind, Detail: def.detail})
+		}
+	}
+
+	for _, keyword := range Token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: COMPLETIONKEYWORD})
+	}
+
+	return items
+}
@@ -0,0 +1,121 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC 2.0 messages, framed the way LSP wants them: a Content-Length header, a blank line and the JSON body
+
+// A request or notification from the client, notifications have no ID
+type request struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *responseError   `json:"error"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	PARSEERROR     = -32700
+	INVALIDREQUEST = -32600
+	METHODNOTFOUND = -32601
+	INVALIDPARAMS  = -32602
+)
+
+// A message that was framed fine but isn't a usable request, the server answers it and keeps going
+type badMessage struct {
+	id  *json.RawMessage
+	err *responseError
+}
+
+func (b *badMessage) Error() string {
+	return b.err.Message
+}
+
+type transport struct {
+	in  *textproto.Reader
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func newTransport(in io.Reader, out io.Writer) *transport {
+	return &transport{in: textproto.NewReader(bufio.NewReader(in)), out: out}
+}
+
+func (t *transport) read() (*request, error) {
+	header, err := t.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(t.in.R, body); err != nil {
+		return nil, err
+	}
+
+	msg := &request{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		if !json.Valid(body) {
+			return nil, &badMessage{err: &responseError{Code: PARSEERROR, Message: fmt.Sprintf("parse error: %s", err)}}
+		}
+
+		// Valid JSON of the wrong shape, answer with its id if it has a readable one
+		var withID struct {
+			ID *json.RawMessage `json:"id"`
+		}
+		json.Unmarshal(body, &withID)
+
+		return nil, &badMessage{id: withID.ID, err: &responseError{Code: INVALIDREQUEST, Message: fmt.Sprintf("invalid request: %s", err)}}
+	}
+
+	return msg, nil
+}
+
+func (t *transport) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := fmt.Fprintf(t.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+
+	_, err = t.out.Write(body)
+	return err
+}
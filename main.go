@@ -1,16 +1,30 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github/FabioVV/comp_lang/compiler"
-	lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/formatter"
+	"github/FabioVV/comp_lang/linter"
+	"github/FabioVV/comp_lang/lsp"
 	object "github/FabioVV/comp_lang/object"
-	parser "github/FabioVV/comp_lang/parser"
 	repl "github/FabioVV/comp_lang/repl"
+	"github/FabioVV/comp_lang/tester"
 	"github/FabioVV/comp_lang/vm"
 	"io"
 	"os"
-	"path/filepath"
+)
+
+// What the process exits with, each kind of failure has its own code so scripts calling momo can tell them apart
+const (
+	EXITFAILURE = 1 // A test failed, a file isn't formatted, lint found something
+	EXITUSAGE   = 2 // Bad flags or arguments, the flag package exits with 2 as well
+	EXITIO      = 3 // A file couldn't be read or written
+	EXITPARSE   = 4
+	EXITCOMPILE = 5
+	EXITRUNTIME = 6
+
+	EXITINTERRUPT = 130 // Stopped with ctrl-c, what shells report for SIGINT
 )
 
 func printParseErrors(out io.Writer, errors []*object.Error) {
@@ -27,89 +41,226 @@ func printCompilerError(out io.Writer, _error *object.Error) {
 	io.WriteString(out, "\t"+_error.Inspect()+"\n")
 }
 
-func main() {
+func writeProfile(profiler *vm.Profiler, path string) error {
+	report, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
 
-	if len(os.Args) < 2 {
-		repl.Start(os.Stdin, os.Stdout)
-		return
+	if err := profiler.WriteReport(report); err != nil {
+		return err
 	}
 
-	var cwd, err = os.Getwd()
-	var path string
+	folded, err := os.Create(path + ".folded")
+	if err != nil {
+		return err
+	}
+	defer folded.Close()
+
+	return profiler.WriteCollapsed(folded)
+}
 
+func writeCoverage(cov *vm.Coverage, path string) error {
+	lcov, err := os.Create(path)
 	if err != nil {
-		return
+		return err
 	}
+	defer lcov.Close()
 
-	filePath := os.Args[1]
+	if err := cov.WriteLCOV(lcov); err != nil {
+		return err
+	}
 
-	_, err = os.Stat(filePath)
+	return cov.WriteSummary(os.Stderr)
+}
+
+// momo test [paths...] runs every test_* function of every *_test.momo file under paths
+func runTests(paths []string) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	ok, err := tester.Run(paths, os.Stdout)
 
 	if err != nil {
-		if filePath == "-help" || filePath == "help" {
-			fmt.Println("Usage: go run main.go <path-to-file>\nor\nUsage: go run main.go")
-			fmt.Println("If executed without arguments it will start the REPL else it will execute the file")
-			return
-		}
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+		os.Exit(EXITIO)
 	}
 
-	if filepath.IsAbs(filePath) {
-		path = filePath
-	} else {
-		path = filepath.Join(cwd, filePath)
+	if !ok {
+		os.Exit(EXITFAILURE)
 	}
+}
+
+/*
+momo fmt [--check] [paths...] rewrites every .momo file under paths in the canonical format.
+With --check nothing is written, the files that aren't formatted are listed and the exit code is 1 if there are any.
+momo fmt - formats stdin to stdout
+*/
+func runFmt(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "only list the files that aren't formatted, exit with 1 if there are any")
+	flags.Parse(args)
+
+	if flags.NArg() == 1 && flags.Arg(0) == "-" {
+		formatted, err := formatter.Format(os.Stdin, "<stdin>")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+			os.Exit(EXITPARSE)
+		}
 
-	if os.IsNotExist(err) {
-		fmt.Printf("momo-pre-alpha - can't open file '%s'\nDoes the file exists? is the path correct?\n", path)
+		os.Stdout.Write(formatted)
 		return
 	}
 
-	file, err := os.Open(filePath)
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
 
+	files, err := formatter.Files(paths)
 	if err != nil {
-		fmt.Printf("momo-pre-pre-alpha - failed to open file: %s\n", err)
-		return
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+		os.Exit(EXITIO)
 	}
 
-	defer file.Close()
+	failed := false
+
+	for _, file := range files {
+		formatted, changed, err := formatter.FormatFile(file)
 
-	// constants := []object.Object{}
-	// globals := make([]object.Object, vm.GLOBALSSIZE)
-	symbolTable := compiler.NewSymbolTable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			failed = true
+			continue
+		}
+
+		if !changed {
+			continue
+		}
 
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(v.Name, i)
+		fmt.Println(file)
+
+		if *check {
+			failed = true
+			continue
+		}
+
+		if err := os.WriteFile(file, formatted, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+			failed = true
+		}
 	}
 
-	l := lexer.New(file, file.Name())
-	p := parser.New(l)
-	program := p.ParseProgram()
+	if failed {
+		os.Exit(EXITFAILURE)
+	}
+}
 
-	if len(p.Errors()) != 0 {
-		printParseErrors(os.Stdout, p.Errors())
-		return
+// momo lint [paths...] lints every .momo file under paths, the exit code is 1 if there were any warnings
+func runLint(paths []string) {
+	if len(paths) == 0 {
+		paths = []string{"."}
 	}
 
-	comp := compiler.New()
-	err_obj := comp.Compile(program)
+	files, err := formatter.Files(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+		os.Exit(EXITIO)
+	}
 
-	if err_obj != nil {
-		printCompilerError(os.Stdout, err_obj)
-		return
+	failed := false
+
+	for _, file := range files {
+		warnings, parseErrors, err := linter.LintFile(file)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+			failed = true
+			continue
+		}
+
+		if len(parseErrors) != 0 {
+			printParseErrors(os.Stderr, parseErrors)
+			failed = true
+			continue
+		}
+
+		for _, w := range warnings {
+			fmt.Println(w)
+			failed = true
+		}
 	}
 
-	code := comp.Bytecode()
+	if failed {
+		os.Exit(EXITFAILURE)
+	}
+}
 
-	machine := vm.NewVM(code)
-	err = machine.Run()
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: momo <command> [flags] [arguments]\nor\nUsage: momo <file> [script arguments...]")
+	fmt.Fprintln(out, "Without arguments the REPL starts, given a file it is run like momo run would")
+	fmt.Fprintln(out, "\nCommands:")
+	fmt.Fprintln(out, "  run [flags] <file | -e code | -> [args...]   compile and run a script, - or no file reads it from stdin")
+	fmt.Fprintln(out, "  repl                                         start the REPL")
+	fmt.Fprintln(out, "  build [-o out] <file>                        compile a script to a "+compiler.BYTECODESUFFIX+" file momo run can load")
+	fmt.Fprintln(out, "  disasm <file | -e code>                      show the bytecode a script compiles to")
+	fmt.Fprintln(out, "  tokens <file | -e code>                      show the tokens the lexer reads")
+	fmt.Fprintln(out, "  ast <file | -e code>                         show the syntax tree the parser builds")
+	fmt.Fprintln(out, "  check [paths...]                             parse and compile the .momo files under paths without running them")
+	fmt.Fprintln(out, "  fmt [--check] [paths...]                     format the .momo files under paths in place, - formats stdin")
+	fmt.Fprintln(out, "  lint [paths...]                              report unused and shadowed names, unreachable code and other likely mistakes")
+	fmt.Fprintln(out, "  test [paths...]                              run every test_* function in the *_test.momo files under paths")
+	fmt.Fprintln(out, "  lsp                                          start the language server, speaking LSP over stdin and stdout")
+	fmt.Fprintln(out, "\nRun 'momo <command> -h' for the flags of a command")
+	fmt.Fprintln(out, "\nExit codes:")
+	fmt.Fprintf(out, "  %d  a test failed, a file isn't formatted or lint found something\n", EXITFAILURE)
+	fmt.Fprintf(out, "  %d  bad flags or arguments\n", EXITUSAGE)
+	fmt.Fprintf(out, "  %d  a file couldn't be read or written\n", EXITIO)
+	fmt.Fprintf(out, "  %d  the script has syntax errors\n", EXITPARSE)
+	fmt.Fprintf(out, "  %d  the script doesn't compile\n", EXITCOMPILE)
+	fmt.Fprintf(out, "  %d  the script failed while running\n", EXITRUNTIME)
+}
 
-	if err != nil {
-		fmt.Fprintf(os.Stdout, "executing bytecode failed:\n %s\n", err)
+func main() {
+	args := os.Args[1:]
+
+	if len(args) == 0 {
+		repl.Start(os.Stdin, os.Stdout)
 		return
 	}
 
-	lastPopped := machine.LastPoppedStackElement()
-	io.WriteString(os.Stdout, lastPopped.Inspect())
-	io.WriteString(os.Stdout, "\n")
-
+	switch args[0] {
+	case "run":
+		runScript(args[1:])
+	case "repl":
+		repl.Start(os.Stdin, os.Stdout)
+	case "build":
+		runBuild(args[1:])
+	case "disasm":
+		runDisasm(args[1:])
+	case "tokens":
+		runTokens(args[1:])
+	case "ast":
+		runAst(args[1:])
+	case "check":
+		runCheck(args[1:])
+	case "fmt":
+		runFmt(args[1:])
+	case "lint":
+		runLint(args[1:])
+	case "test":
+		runTests(args[1:])
+	case "lsp":
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+			os.Exit(EXITFAILURE)
+		}
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+	default:
+		// momo [flags] file args... is short for momo run
+		runScript(args)
+	}
 }
@@ -0,0 +1,103 @@
+package Object
+
+// Builtins for writing tests in momo itself. A failing assertion returns an *AssertionFailure,
+// which makes the VM stop with an error pointing at the assert call.
+
+// assert(condition) or assert(condition, "message")
+func assert(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments for 'assert'. got=%d, want=1 or 2", len(args))
+	}
+
+	if isTruthy(args[0]) {
+		return nil
+	}
+
+	message := "assertion failed"
+	if len(args) == 2 {
+		message = args[1].Inspect()
+	}
+
+	return &AssertionFailure{Message: message}
+}
+
+// assert_eq(actual, expected) or assert_eq(actual, expected, "message")
+func assertEq(args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments for 'assert_eq'. got=%d, want=2 or 3", len(args))
+	}
+
+	actual, expected := args[0], args[1]
+
+	if Equal(actual, expected) {
+		return nil
+	}
+
+	message := "assert_eq failed: values are not equal"
+	if len(args) == 3 {
+		message = args[2].Inspect()
+	}
+
+	return &AssertionFailure{
+		Message:  message,
+		Expected: describe(expected),
+		Actual:   describe(actual),
+	}
+}
+
+// assert_error(value) passes if value is an error, assert_error(fn) passes if calling fn fails
+// or returns an error
+func assertError(host Host, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments for 'assert_error'. got=%d, want=1 or 2", len(args))
+	}
+
+	value := args[0]
+
+	switch value.(type) {
+	case *Closure, *Builtin:
+		result, err := host.Call(value)
+		if err != nil {
+			// A runtime error is what's expected, an assertion failing in fn or fn calling exit still stops the program
+			if _, ok := err.(Halt); ok {
+				return &Halted{Err: err}
+			}
+
+			return nil
+		}
+
+		value = result
+	}
+
+	if _, ok := value.(*Error); ok {
+		return nil
+	}
+
+	message := "assert_error failed: no error happened"
+	if len(args) == 2 {
+		message = args[1].Inspect()
+	}
+
+	return &AssertionFailure{Message: message, Expected: "an error", Actual: describe(value)}
+}
+
+func describe(obj Object) string {
+	if obj.Type() == STRING_OBJ {
+		return "\"" + obj.Inspect() + "\""
+	}
+
+	return obj.Inspect()
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+
+	case *Null:
+		return false
+
+	default:
+		return true
+	}
+}
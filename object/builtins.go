@@ -1,5 +1,10 @@
 package Object
 
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
 // import (
 // 	token "github/FabioVV/comp_lang/token"
 // )
@@ -31,9 +36,148 @@ var Builtins = []struct {
 		// &Builtin{Fn: func(token token.Token, args ...Object) Object {
 
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
-			return nil
-		},
-		},
+		&Builtin{Fn: length},
+	},
+	{
+		"assert",
+		&Builtin{Fn: assert},
+	},
+	{
+		"assert_eq",
+		&Builtin{Fn: assertEq},
+	},
+	{
+		"assert_error",
+		&Builtin{HostFn: assertError},
+	},
+	{
+		"puts",
+		&Builtin{Fn: puts},
+	},
+	{
+		"print",
+		&Builtin{Fn: printValues},
+	},
+	{
+		"args",
+		&Builtin{Value: scriptArgs},
+	},
+	{
+		"env",
+		&Builtin{Fn: env},
 	},
+	{
+		"set_env",
+		&Builtin{Fn: setEnv},
+	},
+	{
+		"exit",
+		&Builtin{Fn: exit},
+	},
+	{
+		"set",
+		&Builtin{Fn: newSet},
+	},
+	{
+		"keys",
+		&Builtin{Fn: hashKeys},
+	},
+	{
+		"values",
+		&Builtin{Fn: hashValues},
+	},
+	{
+		"tuple",
+		&Builtin{Fn: newTuple},
+	},
+	{
+		"identical",
+		&Builtin{Fn: identical},
+	},
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// The native modules in lib report failures the same way the builtins do, without a source position
+func NewBuiltinError(format string, a ...interface{}) *Error {
+	return newError(format, a...)
+}
+
+/*
+What a builtin returns when a function it called back into failed. An assertion failing or exit being called
+in the callback goes on as it is, anything else becomes an error value saying which builtin it happened in.
+*/
+func NewCallbackError(name string, err error) Object {
+	if _, ok := err.(Halt); ok {
+		return &Halted{Err: err}
+	}
+
+	return newError("%s: %s", name, err)
+}
+
+// len(x) is how many characters a string has, or how many elements an array, tuple, hash or set has
+func length(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments for 'len'. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *Array:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *Tuple:
+		return &Integer{Value: int64(len(arg.Elements))}
+	case *Hash:
+		return &Integer{Value: int64(arg.Len())}
+	case *Set:
+		return &Integer{Value: int64(arg.Len())}
+	}
+
+	return newError("argument to 'len' not supported, got %s", args[0].Type())
+}
+
+// keys(h) is an array of the hash's keys, in the order they were added
+func hashKeys(args ...Object) Object {
+	h, err := oneHash("keys", args)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]Object, h.Len())
+	for i, pair := range h.Pairs() {
+		keys[i] = pair.Key
+	}
+
+	return &Array{Elements: keys}
+}
+
+// values(h) is an array of the hash's values, in the same order as keys(h)
+func hashValues(args ...Object) Object {
+	h, err := oneHash("values", args)
+	if err != nil {
+		return err
+	}
+
+	values := make([]Object, h.Len())
+	for i, pair := range h.Pairs() {
+		values[i] = pair.Value
+	}
+
+	return &Array{Elements: values}
+}
+
+func oneHash(name string, args []Object) (*Hash, *Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments for '%s'. got=%d, want=1", name, len(args))
+	}
+
+	h, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to '%s' must be a HASH, got %s", name, args[0].Type())
+	}
+
+	return h, nil
 }
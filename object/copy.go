@@ -0,0 +1,70 @@
+package Object
+
+/*
+Copy gives obj as a value of its own, nothing done to the copy shows in obj. Sets are the only values momo
+code changes, so what can't hold a set is shared rather than copied. copies maps what was copied already to
+its copy, so a value reachable twice is copied once and the copy keeps its shape. Functions bound to a set,
+like s.add, stay bound to the original set.
+*/
+func Copy(obj Object, copies map[Object]Object) Object {
+	if copied, ok := copies[obj]; ok {
+		return copied
+	}
+
+	switch obj := obj.(type) {
+	case *Set:
+		s := NewSet()
+		copies[obj] = s
+
+		for key, bucket := range obj.elements {
+			s.elements[key] = append([]Hashable{}, bucket...)
+		}
+		s.size = obj.size
+
+		return s
+
+	case *Array:
+		arr := &Array{Elements: make([]Object, len(obj.Elements))}
+		copies[obj] = arr
+
+		for i, el := range obj.Elements {
+			arr.Elements[i] = Copy(el, copies)
+		}
+
+		return arr
+
+	case *Hash:
+		hash := NewHash()
+		copies[obj] = hash
+
+		for _, pair := range obj.Pairs() {
+			hash.Set(pair.Key.(Hashable), Copy(pair.Value, copies))
+		}
+
+		return hash
+
+	case *Closure:
+		cl := &Closure{Fn: obj.Fn, Free: make([]Object, len(obj.Free))}
+		copies[obj] = cl
+
+		for i, free := range obj.Free {
+			cl.Free[i] = Copy(free, copies)
+		}
+
+		return cl
+
+	case *TypeDef:
+		if obj.Attributes == nil {
+			return obj
+		}
+
+		def := &TypeDef{Name: obj.Name}
+		copies[obj] = def
+		def.Attributes = Copy(obj.Attributes, copies).(*Hash)
+
+		return def
+	}
+
+	// Tuples only hold hashable values, which can't be sets
+	return obj
+}
@@ -0,0 +1,138 @@
+package Object
+
+import "math"
+
+/*
+Equal is what == means. Numbers are equal when they have the same value, whether they're integers or floats,
+and nan isn't equal to anything, itself included. Strings, booleans and null compare by value, arrays, tuples,
+hashes, sets and typedefs by what they hold, hashes and typedefs in any order. Anything else, like functions,
+is only equal to itself, see Identical.
+*/
+func Equal(a Object, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return sameNumber(b.Value, a.Value)
+		}
+
+	case *Float:
+		switch b := b.(type) {
+		case *Float:
+			return a.Value == b.Value
+		case *Integer:
+			return sameNumber(a.Value, b.Value)
+		}
+
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && equalElements(a.Elements, b.Elements)
+
+	case *Tuple:
+		b, ok := b.(*Tuple)
+		return ok && equalElements(a.Elements, b.Elements)
+
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && equalHashes(a, b)
+
+	case *Set:
+		b, ok := b.(*Set)
+		return ok && a.Equal(b)
+
+	case *TypeDef:
+		b, ok := b.(*TypeDef)
+		return ok && a.Name == b.Name && equalHashes(a.Attributes, b.Attributes)
+	}
+
+	return a == b
+}
+
+/*
+Identical is whether a and b are the same object. Numbers, booleans and null have no identity of their own,
+so they're identical when they're equal and of the same type. Floats go by Float.SameKey, so nan is identical
+to itself and a nan in an array or a set can be found.
+*/
+func Identical(a Object, b Object) bool {
+	switch a := a.(type) {
+	case *Float:
+		b, ok := b.(*Float)
+		return ok && a.SameKey(b)
+
+	case *Integer, *Boolean, *Null:
+		return a.Type() == b.Type() && Equal(a, b)
+	}
+
+	return a == b
+}
+
+// identical(a, b) is whether a and b are the same object, a == b only asks whether they're equal
+func identical(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments for 'identical'. got=%d, want=2", len(args))
+	}
+
+	return &Boolean{Value: Identical(args[0], args[1])}
+}
+
+// Whether the float f is exactly the integer i, 2^53 + 1 isn't the float nearest to it
+func sameNumber(f float64, i int64) bool {
+	return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && int64(f) == i
+}
+
+func equalElements(a []Object, b []Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Hashes are equal when they have the same keys with equal values, in whatever order they were added
+func equalHashes(a *Hash, b *Hash) bool {
+	if hashLen(a) != hashLen(b) {
+		return false
+	}
+
+	if a == nil || b == nil {
+		return true
+	}
+
+	for _, pair := range a.Pairs() {
+		value, ok := b.Get(pair.Key.(Hashable))
+		if !ok || !Equal(pair.Value, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A typedef without attributes may have no hash for them
+func hashLen(h *Hash) int {
+	if h == nil {
+		return 0
+	}
+
+	return h.Len()
+}
@@ -0,0 +1,161 @@
+package Object
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+/*
+AsKey is obj as a hash key, if it can be one. Booleans, integers, floats and strings always can, tuples and
+typedefs when everything they hold can too.
+*/
+func AsKey(obj Object) (Hashable, bool) {
+	switch obj := obj.(type) {
+	case *Tuple:
+		for _, el := range obj.Elements {
+			if _, ok := AsKey(el); !ok {
+				return nil, false
+			}
+		}
+
+	case *TypeDef:
+		if obj.Attributes == nil {
+			return obj, true
+		}
+
+		for _, pair := range obj.Attributes.Pairs() {
+			if _, ok := AsKey(pair.Value); !ok {
+				return nil, false
+			}
+		}
+	}
+
+	key, ok := obj.(Hashable)
+	return key, ok
+}
+
+// tuple(a, b, ...) is a tuple of its arguments, tuple(array) a frozen copy of the array
+func newTuple(args ...Object) Object {
+	elements := args
+
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			elements = arr.Elements
+		}
+	}
+
+	return &Tuple{Elements: append([]Object{}, elements...)}
+}
+
+// Whether a and b are the same key. Only meaningful once AsKey said a is usable
+func sameKey(a Object, b Object) bool {
+	key, ok := a.(Hashable)
+	return ok && key.SameKey(b)
+}
+
+/*
+Whole floats are the same key as the integer with their value, so {1: "a"}[1.0] finds "a". 0.0 and -0.0 are
+the same key, and so is every nan, even though nan == nan is false, otherwise a nan key could never be found.
+*/
+func (f *Float) HashKey() HashKey {
+	switch {
+	case math.IsNaN(f.Value):
+		return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(math.NaN())}
+
+	case f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64:
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+
+	return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f.Value)}
+}
+
+func (f *Float) SameKey(other Object) bool {
+	switch o := other.(type) {
+	case *Float:
+		if math.IsNaN(f.Value) {
+			return math.IsNaN(o.Value)
+		}
+		return o.Value == f.Value
+
+	case *Integer:
+		return sameNumber(f.Value, o.Value)
+	}
+
+	return false
+}
+
+// Hashes the keys of the elements in order, so tuple(1, 2) and tuple(2, 1) are different keys
+func (t *Tuple) HashKey() HashKey {
+	h := fnv.New64a()
+
+	for _, el := range t.Elements {
+		writeKey(h, el.(Hashable).HashKey())
+	}
+
+	return HashKey{Type: t.Type(), Value: h.Sum64()}
+}
+
+func (t *Tuple) SameKey(other Object) bool {
+	o, ok := other.(*Tuple)
+	if !ok || len(o.Elements) != len(t.Elements) {
+		return false
+	}
+
+	for i, el := range t.Elements {
+		if !sameKey(el, o.Elements[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Typedefs with the same name and the same attributes are the same key, whatever order the attributes are in
+func (f *TypeDef) HashKey() HashKey {
+	name := fnv.New64a()
+	name.Write([]byte(f.Name))
+
+	value := name.Sum64()
+
+	if f.Attributes != nil {
+		for _, pair := range f.Attributes.Pairs() {
+			h := fnv.New64a()
+			writeKey(h, pair.Key.(Hashable).HashKey())
+			writeKey(h, pair.Value.(Hashable).HashKey())
+
+			// Adding the attributes' hashes up doesn't depend on their order
+			value += h.Sum64()
+		}
+	}
+
+	return HashKey{Type: f.Type(), Value: value}
+}
+
+func (f *TypeDef) SameKey(other Object) bool {
+	o, ok := other.(*TypeDef)
+	if !ok || o.Name != f.Name || hashLen(o.Attributes) != hashLen(f.Attributes) {
+		return false
+	}
+
+	if f.Attributes == nil {
+		return true
+	}
+
+	for _, pair := range f.Attributes.Pairs() {
+		value, ok := o.Attributes.Get(pair.Key.(Hashable))
+		if !ok || !sameKey(pair.Value, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeKey(h interface{ Write([]byte) (int, error) }, key HashKey) {
+	var value [8]byte
+	binary.LittleEndian.PutUint64(value[:], key.Value)
+
+	h.Write([]byte(key.Type))
+	h.Write(value[:])
+}
@@ -7,7 +7,12 @@ import (
 	"github/FabioVV/comp_lang/code"
 	Token "github/FabioVV/comp_lang/token"
 	"hash/fnv"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type ObjectType string
@@ -16,6 +21,36 @@ type ObjectType string
 type BuiltInFunction func(args ...Object) Object
 type LibFunction interface{}
 
+// What builtins that need the running VM get handed. The VM implements it
+type Host interface {
+	// Calls a momo function (closure or builtin) and returns its result
+	Call(fn Object, args ...Object) (Object, error)
+
+	// Where in the source the builtin was called from, empty if the compiler didn't record it
+	Position() code.SourcePos
+
+	// Closed when the running program is cancelled, builtins that wait should stop when it is
+	Done() <-chan struct{}
+
+	// Whether the program may use a capability, builtins check before doing anything it covers
+	Allows(capability string) bool
+
+	/*
+		A host of its own for calling momo functions from another goroutine. It has its own stack and its own copy
+		of the globals and of values, given back in the same order, so the hosts never change each other's state
+	*/
+	Spawn(values ...Object) (Host, []Object)
+}
+
+// Capabilities a host can take away from the programs it runs
+const (
+	CAPABILITYPROC = "proc" // Running other programs
+	CAPABILITYNET  = "net"  // Making and serving network requests
+)
+
+// A builtin that can call back into the VM running it
+type HostFunction func(host Host, args ...Object) Object
+
 const (
 	INTEGER_OBJ           = "INTEGER"
 	FLOAT_OBJ             = "FLOAT"
@@ -36,6 +71,13 @@ const (
 	BUILTIN_OBJ           = "BUILTIN"
 	CLOSURE_OBJ           = "CLOSURE"
 	LIB_OBJ               = "LIB_FN"
+	ASSERTION_OBJ         = "ASSERTION_FAILURE"
+	EXIT_OBJ              = "EXIT"
+	HALTED_OBJ            = "HALTED"
+	REGEX_OBJ             = "REGEX"
+	TIME_OBJ              = "TIME"
+	SET_OBJ               = "SET"
+	TUPLE_OBJ             = "TUPLE"
 )
 
 type Object interface {
@@ -52,6 +94,8 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Name          string         // Empty for anonymous functions
+	SourceMap     code.SourceMap // Instruction offsets -> source lines
 }
 
 type Error struct {
@@ -76,8 +120,10 @@ type Float struct {
 	Value float64
 }
 
+// Strings never change once made, so the hash of Value is worked out once and kept
 type String struct {
 	Value string
+	hash  uint64 // 0 until HashKey first runs, read and written atomically since hosts share constants
 }
 
 type Boolean struct {
@@ -88,6 +134,11 @@ type Array struct {
 	Elements []Object
 }
 
+// A frozen array. It can't be changed, so it can be a hash key when its elements can
+type Tuple struct {
+	Elements []Object
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
@@ -103,12 +154,31 @@ type HashKey struct {
 	Value uint64
 }
 
+/*
+Pairs stay in the order their keys were first set, index finds a pair's place from its key. Different keys
+can have the same HashKey, the first one goes in index and the others in collisions, every lookup compares
+the keys themselves so they never overwrite each other.
+*/
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs      []HashPair
+	index      map[HashKey]int
+	collisions map[HashKey][]int
 }
 
+/*
+Values that can be hash keys and set elements. HashKey buckets them, SameKey tells apart those it puts together.
+Tuples and typedefs are only usable when everything in them is, ask AsKey rather than checking for Hashable.
+*/
 type Hashable interface {
+	Object
 	HashKey() HashKey
+	SameKey(other Object) bool
+}
+
+// A collection of distinct hashable values, bucketed by HashKey like the pairs of a hash
+type Set struct {
+	elements map[HashKey][]Hashable
+	size     int
 }
 
 type Type struct {
@@ -122,7 +192,42 @@ type Function struct {
 }
 
 type Builtin struct {
-	Fn BuiltInFunction
+	Fn     BuiltInFunction
+	HostFn HostFunction  // Used instead of Fn when set
+	Value  func() Object // Set for builtin values like args, loading one gives its value instead of the builtin
+}
+
+// Returned by the assert builtins when the assertion does not hold. The VM stops running when it sees one
+type AssertionFailure struct {
+	Message  string
+	Expected string // Inspect() of the expected value, empty if the assertion doesn't compare values
+	Actual   string
+}
+
+// Returned by the exit builtin. The VM stops running when it sees one and Run reports the exit code
+type Exit struct {
+	Code int
+}
+
+// Errors from Host.Call that have to stop the whole program, like a failed assertion or an exit
+type Halt interface {
+	error
+	Halts()
+}
+
+// Returned by builtins whose callback halted. The VM stops with Err as it is, not with an error about the builtin
+type Halted struct {
+	Err error
+}
+
+// A compiled regular expression, made by the re module
+type Regex struct {
+	Regexp *regexp.Regexp
+}
+
+// An instant in time, made by the time module. Times from time.now() also carry a monotonic clock reading
+type Time struct {
+	Value time.Time
 }
 
 type Lib struct {
@@ -145,20 +250,6 @@ var (
 	CONTINUE = ContinueValue{}
 )
 
-/*
-
-Granted, there’s one more thing we could do before moving on: we could optimize the perfor-
-mance of the HashKey() methods by caching their return values, but that sounds like a nice
-exercise for the performance-minded reader.
-
-
-There is still a possibility, albeit a small one, that different Strings with different Values result
-in the same hash. That happens when the hash/fnv package generates the same integer for
-different values, an event called a hash collision. Chances that we experience it are low, but it
-should be noted that there are well-known techniques such as “separate chaining” and “open
-addressing” to work around the problem. Implementing one of these mitigations is outside of
-this book’s scope, but certainly a nice exercise for the curious reader.*/
-
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("closure [%p]", c)
@@ -186,17 +277,63 @@ func (i *Integer) HashKey() HashKey {
 }
 
 func (s *String) HashKey() HashKey {
+	value := atomic.LoadUint64(&s.hash)
+
+	if value == 0 {
+		h := fnv.New64a()
+		h.Write([]byte(s.Value))
+
+		value = h.Sum64()
+		atomic.StoreUint64(&s.hash, value)
+	}
+
+	return HashKey{Type: s.Type(), Value: value}
+}
 
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
+func (b *Boolean) SameKey(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && o.Value == b.Value
+}
+
+// An integer is the same key as a float with the same value, see Float.HashKey
+func (i *Integer) SameKey(other Object) bool {
+	switch o := other.(type) {
+	case *Integer:
+		return o.Value == i.Value
+	case *Float:
+		return o.SameKey(i)
+	}
 
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return false
+}
+
+func (s *String) SameKey(other Object) bool {
+	o, ok := other.(*String)
+	return ok && o.Value == s.Value
 }
 
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
-func (i *Float) Inspect() string  { return fmt.Sprintf("%.1f", i.Value) }
+// As few digits as it takes to read the same float back, whole numbers keep a .0 so they don't look like integers
+func (i *Float) Inspect() string {
+	switch {
+	case math.IsNaN(i.Value):
+		return "nan"
+	case math.IsInf(i.Value, 1):
+		return "inf"
+	case math.IsInf(i.Value, -1):
+		return "-inf"
+	}
+
+	s := strconv.FormatFloat(i.Value, 'g', -1, 64)
+
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
 func (i *Float) Type() ObjectType { return FLOAT_OBJ }
 
 func (s *String) formatEscapeSequence() string {
@@ -252,6 +389,17 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string {
+	elements := []string{}
+
+	for _, e := range t.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	return "tuple(" + strings.Join(elements, ", ") + ")"
+}
+
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 
@@ -286,7 +434,7 @@ func (f *TypeDef) Inspect() string {
 
 	params := []string{}
 
-	for _, p := range f.Attributes.Pairs {
+	for _, p := range f.Attributes.Pairs() {
 		params = append(params, p.Key.Inspect())
 	}
 
@@ -303,6 +451,21 @@ func (f *TypeDef) Type() ObjectType { return TYPE_DEF_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 
+func (af *AssertionFailure) Inspect() string  { return "assertion failed: " + af.Message }
+func (af *AssertionFailure) Type() ObjectType { return ASSERTION_OBJ }
+
+func (e *Exit) Inspect() string  { return fmt.Sprintf("exit(%d)", e.Code) }
+func (e *Exit) Type() ObjectType { return EXIT_OBJ }
+
+func (h *Halted) Inspect() string  { return h.Err.Error() }
+func (h *Halted) Type() ObjectType { return HALTED_OBJ }
+
+func (r *Regex) Inspect() string  { return "/" + r.Regexp.String() + "/" }
+func (r *Regex) Type() ObjectType { return REGEX_OBJ }
+
+func (t *Time) Inspect() string  { return t.Value.Format(time.RFC3339Nano) }
+func (t *Time) Type() ObjectType { return TIME_OBJ }
+
 func (l *Lib) Inspect() string  { return "library function" }
 func (l *Lib) Type() ObjectType { return LIB_OBJ }
 
@@ -315,12 +478,76 @@ func (b *BreakValue) Type() ObjectType { return BREAK_OBJ }
 func (c *ContinueValue) Inspect() string  { return "continue" }
 func (c *ContinueValue) Type() ObjectType { return CONTINUE_OBJ }
 
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey]int)}
+}
+
+// Where the pair for key is in pairs, and the key's HashKey so a caller adding it doesn't work it out again
+func (h *Hash) find(key Hashable) (int, HashKey, bool) {
+	hashKey := key.HashKey()
+
+	i, ok := h.index[hashKey]
+	if !ok {
+		return 0, hashKey, false
+	}
+
+	if key.SameKey(h.pairs[i].Key) {
+		return i, hashKey, true
+	}
+
+	for _, i := range h.collisions[hashKey] {
+		if key.SameKey(h.pairs[i].Key) {
+			return i, hashKey, true
+		}
+	}
+
+	return 0, hashKey, false
+}
+
+// Sets the value of key. A new key goes after the others, a key that's already there keeps its place
+func (h *Hash) Set(key Hashable, value Object) {
+	if h.index == nil {
+		h.index = make(map[HashKey]int)
+	}
+
+	i, hashKey, ok := h.find(key)
+	if ok {
+		h.pairs[i].Value = value
+		return
+	}
+
+	if _, taken := h.index[hashKey]; taken {
+		if h.collisions == nil {
+			h.collisions = make(map[HashKey][]int)
+		}
+		h.collisions[hashKey] = append(h.collisions[hashKey], len(h.pairs))
+	} else {
+		h.index[hashKey] = len(h.pairs)
+	}
+
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, _, ok := h.find(key)
+	if !ok {
+		return nil, false
+	}
+
+	return h.pairs[i].Value, true
+}
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+// The pairs in the order their keys were first set. The slice belongs to the hash, don't change it
+func (h *Hash) Pairs() []HashPair { return h.pairs }
+
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -351,6 +578,11 @@ func (e *Warning) Type() ObjectType { return WARNING_OBJ }
 
 func (e *Error) Inspect() string {
 
+	// Errors made by builtins don't know where they came from
+	if e.Filename == "" && e.Line == 0 {
+		return fmt.Sprintf("ERROR: %s", e.Message)
+	}
+
 	formattedError := fmt.Sprintf("ERROR: %s", e.Message+"\n")
 	formattedError += fmt.Sprintf(" Location: '%s', line %d, column %d", e.Filename, e.Line, e.Column)
 
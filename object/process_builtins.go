@@ -0,0 +1,86 @@
+package Object
+
+import "os"
+
+// The arguments given to the script after its name on the command line
+var arguments = []string{}
+
+// Sets what args evaluates to, the CLI calls it before running a script
+func SetArgs(args []string) {
+	arguments = args
+}
+
+// args is a fresh array every time, so a script changing it can't affect the next read
+func scriptArgs() Object {
+	elements := make([]Object, len(arguments))
+
+	for i, arg := range arguments {
+		elements[i] = &String{Value: arg}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// env(name) is the value of an environment variable, null if it isn't set
+func env(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments for 'env'. got=%d, want=1", len(args))
+	}
+
+	name, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to 'env' must be STRING, got %s", args[0].Type())
+	}
+
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return nil
+	}
+
+	return &String{Value: value}
+}
+
+// set_env(name, value) sets an environment variable for this process and the ones it starts
+func setEnv(args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments for 'set_env'. got=%d, want=2", len(args))
+	}
+
+	name, ok := args[0].(*String)
+	if !ok {
+		return newError("first argument to 'set_env' must be STRING, got %s", args[0].Type())
+	}
+
+	value, ok := args[1].(*String)
+	if !ok {
+		return newError("second argument to 'set_env' must be STRING, got %s", args[1].Type())
+	}
+
+	if err := os.Setenv(name.Value, value.Value); err != nil {
+		return newError("set_env failed: %s", err)
+	}
+
+	return nil
+}
+
+// exit() or exit(code) stops the program, the VM unwinds and the CLI exits with code
+func exit(args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments for 'exit'. got=%d, want=0 or 1", len(args))
+	}
+
+	if len(args) == 0 {
+		return &Exit{Code: 0}
+	}
+
+	code, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to 'exit' must be INTEGER, got %s", args[0].Type())
+	}
+
+	if code.Value < 0 || code.Value > 255 {
+		return newError("exit code must be between 0 and 255, got %d", code.Value)
+	}
+
+	return &Exit{Code: int(code.Value)}
+}
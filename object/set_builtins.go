@@ -0,0 +1,244 @@
+package Object
+
+import (
+	"sort"
+	"strings"
+)
+
+func NewSet() *Set {
+	return &Set{elements: make(map[HashKey][]Hashable)}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+
+// Elements are listed in the order Values gives them, so the same set always prints the same
+func (s *Set) Inspect() string {
+	elements := []string{}
+
+	for _, el := range s.Values() {
+		elements = append(elements, el.Inspect())
+	}
+
+	return "set(" + strings.Join(elements, ", ") + ")"
+}
+
+func (s *Set) Len() int { return s.size }
+
+// The elements sorted by how they print, the map they're kept in has no order of its own
+func (s *Set) Values() []Object {
+	values := make([]Object, 0, s.size)
+
+	for _, bucket := range s.elements {
+		for _, el := range bucket {
+			values = append(values, el)
+		}
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return values[i].Inspect() < values[j].Inspect()
+	})
+
+	return values
+}
+
+// Adds el unless it's already there, it's an error for el not to be hashable
+func (s *Set) Add(el Object) *Error {
+	hashable, ok := AsKey(el)
+	if !ok {
+		return newError("unusable as set element: %s", el.Type())
+	}
+
+	if !s.Has(el) {
+		key := hashable.HashKey()
+		s.elements[key] = append(s.elements[key], hashable)
+		s.size++
+	}
+
+	return nil
+}
+
+func (s *Set) Has(el Object) bool {
+	hashable, ok := AsKey(el)
+	if !ok {
+		return false
+	}
+
+	for _, other := range s.elements[hashable.HashKey()] {
+		if hashable.SameKey(other) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Set) Remove(el Object) {
+	hashable, ok := AsKey(el)
+	if !ok {
+		return
+	}
+
+	key := hashable.HashKey()
+	bucket := s.elements[key]
+
+	for i, other := range bucket {
+		if !hashable.SameKey(other) {
+			continue
+		}
+
+		if len(bucket) == 1 {
+			delete(s.elements, key)
+		} else {
+			s.elements[key] = append(bucket[:i:i], bucket[i+1:]...)
+		}
+
+		s.size--
+		return
+	}
+}
+
+// Sets are equal when they hold the same elements
+func (s *Set) Equal(other *Set) bool {
+	if s.size != other.size {
+		return false
+	}
+
+	for _, bucket := range s.elements {
+		for _, el := range bucket {
+			if !other.Has(el) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// set(a, b, ...) is a set of its arguments, set(array) one of the array's elements
+func newSet(args ...Object) Object {
+	elements := args
+
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			elements = arr.Elements
+		}
+	}
+
+	s := NewSet()
+
+	for _, el := range elements {
+		if err := s.Add(el); err != nil {
+			return err
+		}
+	}
+
+	return s
+}
+
+/*
+The methods a set has, looked up by name when it's used like s.add(x). add and remove change the set and give
+it back, union, intersection and difference make a new one. values is an array of the elements, each calls
+a function with every one of them until it returns false.
+*/
+func SetMethod(s *Set, name string) (*Builtin, bool) {
+	switch name {
+	case "add":
+		return &Builtin{Fn: func(args ...Object) Object {
+			for _, el := range args {
+				if err := s.Add(el); err != nil {
+					return err
+				}
+			}
+			return s
+		}}, true
+
+	case "remove":
+		return &Builtin{Fn: func(args ...Object) Object {
+			for _, el := range args {
+				s.Remove(el)
+			}
+			return s
+		}}, true
+
+	case "has":
+		return &Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments for 'has'. got=%d, want=1", len(args))
+			}
+			return &Boolean{Value: s.Has(args[0])}
+		}}, true
+
+	case "len":
+		return &Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments for 'len'. got=%d, want=0", len(args))
+			}
+			return &Integer{Value: int64(s.Len())}
+		}}, true
+
+	case "union", "intersection", "difference":
+		return &Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments for '%s'. got=%d, want=1", name, len(args))
+			}
+
+			other, ok := args[0].(*Set)
+			if !ok {
+				return newError("argument to '%s' must be a SET, got %s", name, args[0].Type())
+			}
+
+			return combine(name, s, other)
+		}}, true
+
+	case "values":
+		return &Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments for 'values'. got=%d, want=0", len(args))
+			}
+			return &Array{Elements: s.Values()}
+		}}, true
+
+	case "each":
+		return &Builtin{HostFn: func(host Host, args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments for 'each'. got=%d, want=1", len(args))
+			}
+
+			for _, el := range s.Values() {
+				result, err := host.Call(args[0], el)
+				if err != nil {
+					return NewCallbackError("each", err)
+				}
+
+				if b, ok := result.(*Boolean); ok && !b.Value {
+					break
+				}
+			}
+
+			return nil
+		}}, true
+	}
+
+	return nil, false
+}
+
+func combine(name string, s *Set, other *Set) *Set {
+	out := NewSet()
+
+	for _, el := range s.Values() {
+		switch {
+		case name == "union",
+			name == "intersection" && other.Has(el),
+			name == "difference" && !other.Has(el):
+			out.Add(el)
+		}
+	}
+
+	if name == "union" {
+		for _, el := range other.Values() {
+			out.Add(el)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,28 @@
+package Object
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Where puts and print write, tests point it somewhere they can read back
+var Stdout io.Writer = os.Stdout
+
+// puts(values...) writes every value on its own line
+func puts(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprintln(Stdout, arg.Inspect())
+	}
+
+	return nil
+}
+
+// print(values...) writes the values one after the other, without a line break
+func printValues(args ...Object) Object {
+	for _, arg := range args {
+		fmt.Fprint(Stdout, arg.Inspect())
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@ const (
 	LOGICAL     // && or ||
 	EQUALS      // ==
 	LESSGREATER // > or <
+	PIPE        // x | f, looser than arithmetic but tighter than comparisons so x | f == y compares f(x)
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
@@ -25,10 +26,12 @@ const (
 
 // PRECEDENCE TABLE
 var precedences = map[Token.TokenType]int{
+	Token.PIPE:     PIPE,
 	Token.AND:      LOGICAL,
 	Token.OR:       LOGICAL,
 	Token.EQ:       EQUALS,
 	Token.NOT_EQ:   EQUALS,
+	Token.IN:       LESSGREATER,
 	Token.LT:       LESSGREATER,
 	Token.GT:       LESSGREATER,
 	Token.GT_OR_EQ: LESSGREATER,
@@ -94,6 +97,14 @@ func (p *Parser) registerInfix(tokenType Token.TokenType, fn infixParseFN) {
 
 }
 
+// Precedence returns how tightly an infix operator binds, LOWEST if the token isn't one
+func Precedence(t Token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -238,11 +249,23 @@ func (p *Parser) parseReturnStatement() *Ast.ReturnStatement {
 }
 
 func (p *Parser) parseBreakStatement() *Ast.BreakStatement {
-	return &Ast.BreakStatement{Token: p.curToken}
+	stmt := &Ast.BreakStatement{Token: p.curToken}
+
+	if p.peekTokenIs(Token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
 }
 
 func (p *Parser) parseContinueStatement() *Ast.ContinueStatement {
-	return &Ast.ContinueStatement{Token: p.curToken}
+	stmt := &Ast.ContinueStatement{Token: p.curToken}
+
+	if p.peekTokenIs(Token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
 }
 
 func (p *Parser) parseExpression(precedence int) Ast.Expression {
@@ -277,6 +300,19 @@ func (p *Parser) parseExpression(precedence int) Ast.Expression {
 	return leftExp
 }
 
+// A comment on its own is a statement of its own, whatever comes after it is never an operand of it
+func (p *Parser) parseCommentStatement() *Ast.ExpressionStatement {
+	stmt := &Ast.ExpressionStatement{Token: p.curToken}
+
+	if p.curTokenIs(Token.COMMENT) {
+		stmt.Expression = p.parseComment()
+	} else {
+		stmt.Expression = p.parseMultiLineComment()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *Ast.ExpressionStatement {
 	stmt := &Ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -315,6 +351,9 @@ func (p *Parser) parseStatement() Ast.Statement {
 	case Token.CONTINUE:
 		stmt = p.parseContinueStatement()
 
+	case Token.COMMENT, Token.MULTILINE_COMMENT:
+		stmt = p.parseCommentStatement()
+
 	default:
 		stmt = p.parseExpressionStatement()
 
@@ -733,6 +772,7 @@ func (p *Parser) parseTypedefLiteral() Ast.Expression {
 		p.nextToken()
 
 		typedef_exp.Pairs[key.TokenLiteral()] = value
+		typedef_exp.Keys = append(typedef_exp.Keys, key.TokenLiteral())
 
 		if p.curToken.Literal == Token.RBRACE {
 			continue
@@ -832,6 +872,7 @@ func (p *Parser) parseHashLiteral() Ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(Token.RBRACE) && !p.expectPeek(Token.COMMA) {
 			return nil
@@ -910,6 +951,8 @@ func New(l *Lexer.Lexer) *Parser {
 	p.registerInfix(Token.GT_OR_EQ, p.parseInfixExpression)
 	p.registerInfix(Token.LT_OR_EQ, p.parseInfixExpression)
 	p.registerInfix(Token.PERIOD, p.parseInfixExpression)
+	p.registerInfix(Token.PIPE, p.parseInfixExpression)
+	p.registerInfix(Token.IN, p.parseInfixExpression)
 	// NEW
 
 	p.registerInfix(Token.PLUS, p.parseInfixExpression)
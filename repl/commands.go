@@ -0,0 +1,154 @@
+package repl
+
+import (
+	"fmt"
+	Ast "github/FabioVV/comp_lang/ast"
+	"github/FabioVV/comp_lang/compiler"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	Object "github/FabioVV/comp_lang/object"
+	Parser "github/FabioVV/comp_lang/parser"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A REPL meta-command, typed as :name followed by its argument
+type command struct {
+	usage    string
+	help     string
+	needsArg bool
+	run      func(s *session, arg string) bool
+}
+
+var commands map[string]*command
+
+// Filled in init, the commands refer back to the table for :help and completion
+func init() {
+	commands = map[string]*command{
+		":help":    {help: "list the REPL commands", run: (*session).help},
+		":quit":    {help: "leave the REPL", run: func(s *session, arg string) bool { return false }},
+		":load":    {usage: "<file>", help: "run a file in the session, its globals stay defined", needsArg: true, run: (*session).load},
+		":disasm":  {usage: "<expr>", help: "show the bytecode expr compiles to, without running it", needsArg: true, run: (*session).disasm},
+		":ast":     {usage: "<expr>", help: "show the syntax tree expr parses to", needsArg: true, run: (*session).ast},
+		":globals": {help: "list the globals defined so far and their values", run: (*session).listGlobals},
+		":reset":   {help: "forget every global and start over", run: func(s *session, arg string) bool { s.reset(); return true }},
+		":type":    {usage: "<expr>", help: "run expr and show the type of its value", needsArg: true, run: (*session).typeOf},
+		":time":    {usage: "<expr>", help: "run expr and show its value and how long it took", needsArg: true, run: (*session).time},
+	}
+
+	commands[":exit"] = commands[":quit"]
+}
+
+func (s *session) help(arg string) bool {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(s.out, "  %-22s %s\n", strings.TrimSpace(name+" "+cmd.usage), cmd.help)
+	}
+
+	return true
+}
+
+func (s *session) load(path string) bool {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "can't load %s: %s\n", path, err)
+		return true
+	}
+
+	if _, ok := s.eval(string(src), path); ok {
+		fmt.Fprintf(s.out, "loaded %s\n", path)
+	}
+
+	return true
+}
+
+func (s *session) disasm(src string) bool {
+	before := len(s.constants)
+
+	code, ok := s.compile(src, "<stdin>")
+	if !ok {
+		return true
+	}
+
+	io.WriteString(s.out, code.Instructions.MiniDisassembler())
+
+	// Functions defined by expr are constants, their bodies are shown too
+	for i, constant := range code.Constants[before:] {
+		fn, ok := constant.(*Object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+
+		fmt.Fprintf(s.out, "\nconstant %d, fn %s:\n", before+i, name)
+		io.WriteString(s.out, fn.Instructions.MiniDisassembler())
+	}
+
+	return true
+}
+
+func (s *session) ast(src string) bool {
+	p := Parser.New(Lexer.New(strings.NewReader(src), "<stdin>"))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParseErrors(s.out, p.Errors())
+		return true
+	}
+
+	Ast.Dump(s.out, program)
+
+	return true
+}
+
+func (s *session) listGlobals(arg string) bool {
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope != compiler.GLOBALSCOPE {
+			continue
+		}
+
+		value := s.globals[symbol.Index]
+		if value == nil {
+			fmt.Fprintf(s.out, "%s (not set)\n", symbol.Name)
+			continue
+		}
+
+		fmt.Fprintf(s.out, "%s = %s (%s)\n", symbol.Name, value.Inspect(), value.Type())
+	}
+
+	return true
+}
+
+func (s *session) typeOf(src string) bool {
+	if result, ok := s.eval(src, "<stdin>"); ok {
+		fmt.Fprintf(s.out, "%s\n", result.Type())
+	}
+
+	return true
+}
+
+func (s *session) time(src string) bool {
+	start := time.Now()
+	result, ok := s.eval(src, "<stdin>")
+	elapsed := time.Since(start)
+
+	if ok {
+		fmt.Fprintf(s.out, "%s\n", result.Inspect())
+		fmt.Fprintf(s.out, "took %s\n", elapsed)
+	}
+
+	return true
+}
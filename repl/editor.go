@@ -0,0 +1,388 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The file in the home directory the REPL keeps its history in
+const HISTORYFILE string = ".momo_history"
+
+// How many entries the history file keeps, older ones are dropped
+const HISTORYSIZE int = 1000
+
+// Returned by ReadLine when the user presses ctrl-c, the current input is thrown away
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// Reads whole lines with no editing, for pipes, files and tests
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+/*
+editor is a small line editor for terminals: cursor movement, emacs style kill keys, history browsing with
+the arrow keys and tab completion. The terminal is only in raw mode while a line is being read, so the
+program's own output isn't affected.
+*/
+type editor struct {
+	fd      int
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+
+	// Candidates for the word before the cursor
+	complete func(line string, word string) []string
+
+	buf    []rune
+	pos    int
+	prompt string
+}
+
+func newEditor(f *os.File, out io.Writer, h *history, complete func(line string, word string) []string) *editor {
+	return &editor{fd: int(f.Fd()), in: bufio.NewReader(f), out: out, history: h, complete: complete}
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.buf = e.buf[:0]
+	e.pos = 0
+	e.prompt = prompt
+	e.history.rewind()
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(e.buf), nil
+
+		case 3: // ctrl-c
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case 4: // ctrl-d
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+
+		case 127, 8: // backspace
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+
+		case 1: // ctrl-a
+			e.pos = 0
+		case 5: // ctrl-e
+			e.pos = len(e.buf)
+		case 2: // ctrl-b
+			e.left()
+		case 6: // ctrl-f
+			e.right()
+
+		case 11: // ctrl-k
+			e.buf = e.buf[:e.pos]
+
+		case 21: // ctrl-u
+			e.buf = append(e.buf[:0], e.buf[e.pos:]...)
+			e.pos = 0
+
+		case 23: // ctrl-w
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+
+		case 12: // ctrl-l
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+
+		case 16: // ctrl-p
+			e.setLine(e.history.previous(string(e.buf)))
+		case 14: // ctrl-n
+			e.setLine(e.history.next())
+
+		case '\t':
+			e.completeWord()
+
+		case 27:
+			e.escape()
+
+		default:
+			if r >= ' ' {
+				e.buf = append(e.buf, 0)
+				copy(e.buf[e.pos+1:], e.buf[e.pos:])
+				e.buf[e.pos] = r
+				e.pos++
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+// Arrow keys, home, end and delete come as escape sequences
+func (e *editor) escape() {
+	b, err := e.in.ReadByte()
+	if err != nil || b != '[' && b != 'O' {
+		return
+	}
+
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return
+	}
+
+	switch b {
+	case 'A':
+		e.setLine(e.history.previous(string(e.buf)))
+	case 'B':
+		e.setLine(e.history.next())
+	case 'C':
+		e.right()
+	case 'D':
+		e.left()
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+
+	case '1', '3', '4', '7', '8':
+		if t, err := e.in.ReadByte(); err != nil || t != '~' {
+			return
+		}
+
+		switch b {
+		case '1', '7':
+			e.pos = 0
+		case '4', '8':
+			e.pos = len(e.buf)
+		case '3':
+			e.delete()
+		}
+	}
+}
+
+func (e *editor) left() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *editor) right() {
+	if e.pos < len(e.buf) {
+		e.pos++
+	}
+}
+
+// Deletes the rune under the cursor
+func (e *editor) delete() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+func (e *editor) setLine(line string) {
+	// Multi-line entries are edited on one line, momo doesn't care about the line breaks
+	e.buf = []rune(strings.ReplaceAll(line, "\n", " "))
+	e.pos = len(e.buf)
+}
+
+func (e *editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+/*
+Completes the word before the cursor. A single candidate is inserted whole, several are completed up to their
+common prefix and listed when that doesn't add anything.
+*/
+func (e *editor) completeWord() {
+	start := e.pos
+	for start > 0 && (isWordRune(e.buf[start-1]) || start == 1 && e.buf[0] == ':') {
+		start--
+	}
+
+	word := string(e.buf[start:e.pos])
+	candidates := e.complete(string(e.buf), word)
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(candidates) > 1 && prefix == word {
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+		return
+	}
+
+	insert := []rune(prefix[len(word):])
+	e.buf = append(e.buf[:e.pos], append(insert, e.buf[e.pos:]...)...)
+	e.pos += len(insert)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r > 127
+}
+
+/*
+history keeps every entry the user ran. Entries are stored one per line, quoted, so multi-line input survives
+the round trip through the file.
+*/
+type history struct {
+	path    string
+	entries []string
+
+	// Where browsing with up and down currently is, len(entries) is the line being typed
+	cursor  int
+	pending string
+}
+
+func loadHistory(path string) *history {
+	h := &history{path: path}
+
+	if path == "" {
+		return h
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if entry, err := strconv.Unquote(scanner.Text()); err == nil {
+			h.entries = append(h.entries, entry)
+		}
+	}
+
+	if len(h.entries) > HISTORYSIZE {
+		h.entries = h.entries[len(h.entries)-HISTORYSIZE:]
+	}
+
+	return h
+}
+
+// Where the history lives by default, empty if there's no home directory to keep it in
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, HISTORYFILE)
+}
+
+func (h *history) add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+
+	if len(h.entries) > HISTORYSIZE {
+		h.entries = h.entries[len(h.entries)-HISTORYSIZE:]
+	}
+
+	h.save()
+}
+
+func (h *history) save() {
+	if h.path == "" {
+		return
+	}
+
+	var out strings.Builder
+	for _, entry := range h.entries {
+		out.WriteString(strconv.Quote(entry) + "\n")
+	}
+
+	os.WriteFile(h.path, []byte(out.String()), 0600)
+}
+
+func (h *history) rewind() {
+	h.cursor = len(h.entries)
+	h.pending = ""
+}
+
+// The entry before the one shown, current is what's being typed so going back down can restore it
+func (h *history) previous(current string) string {
+	if h.cursor == len(h.entries) {
+		h.pending = current
+	}
+
+	if h.cursor > 0 {
+		h.cursor--
+	}
+
+	if h.cursor == len(h.entries) {
+		return h.pending
+	}
+
+	return h.entries[h.cursor]
+}
+
+func (h *history) next() string {
+	if h.cursor < len(h.entries) {
+		h.cursor++
+	}
+
+	if h.cursor == len(h.entries) {
+		return h.pending
+	}
+
+	return h.entries[h.cursor]
+}
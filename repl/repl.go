@@ -2,23 +2,29 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github/FabioVV/comp_lang/compiler"
 	Lexer "github/FabioVV/comp_lang/lexer"
 	Object "github/FabioVV/comp_lang/object"
 	Parser "github/FabioVV/comp_lang/parser"
+	Token "github/FabioVV/comp_lang/token"
 	"github/FabioVV/comp_lang/vm"
 	"io"
 	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 )
 
 const PROMPT string = "!>> "
 
+// Shown while an entry is still missing a closing brace, paren, bracket or quote
+const CONTINUEPROMPT string = "... "
+
 const DRAW string = ``
 
 /*
@@ -57,13 +63,13 @@ func ClearScreen() {
 	}
 }
 
-func Start(in io.Reader, out io.Writer) {
-	ClearScreen()
-
-	scanner := bufio.NewScanner(in)
-
+func greet(out io.Writer) {
 	user, err := user.Current()
-	username := user.Username
+	username := "Coder"
+	if err == nil {
+		username = user.Username
+	}
+
 	currentTime := time.Now()
 	hour := currentTime.Hour()
 	platform := runtime.GOOS
@@ -80,68 +86,257 @@ func Start(in io.Reader, out io.Writer) {
 
 	}
 
-	if err != nil {
-		username = "Coder"
-	}
+	fmt.Fprintf(out, "{Momo compiler pre-pre-alpha } : {%s} : {%s}\n", currentTime, platform)
 
-	fmt.Printf("{Momo compiler pre-pre-alpha } : {%s} : {%s}\n", currentTime, platform)
+	fmt.Fprintf(out, "Hello %s \n", username)
+	fmt.Fprintf(out, "%s\n", message)
 
-	fmt.Printf("Hello %s \n", username)
-	fmt.Printf("%s\n", message)
+	fmt.Fprintf(out, "Feel free to type in commands, :help lists the REPL commands\n")
+}
+
+/*
+Start runs the REPL. On a terminal it greets the user and edits lines with history and tab completion,
+anything else (a pipe, a file) is read line by line so the REPL can be scripted.
+*/
+func Start(in io.Reader, out io.Writer) {
+	s := newSession(out)
 
-	fmt.Printf("Feel free to type in commands\n")
+	var reader lineReader
 
-	constants := []Object.Object{}
-	globals := make([]Object.Object, vm.GLOBALSSIZE)
-	symbolTable := compiler.NewSymbolTable()
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		ClearScreen()
+		greet(out)
 
-	for i, v := range Object.Builtins {
-		symbolTable.DefineBuiltin(v.Name, i)
+		s.history = loadHistory(defaultHistoryPath())
+		reader = newEditor(f, out, s.history, s.completions)
+	} else {
+		reader = &plainReader{in: bufio.NewReader(in), out: out}
 	}
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
+		entry, err := readEntry(reader)
 
-		if !scanned {
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+
+		if err != nil {
 			return
 		}
 
-		line := scanner.Text()
-		reader := strings.NewReader(line)
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
 
-		l := Lexer.New(reader, "<stdin>")
-		p := Parser.New(l)
-		program := p.ParseProgram()
+		s.history.add(entry)
 
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
-			// continue, we dont want the REPL to exit on error
-			continue
+		if !s.execute(entry) {
+			return
 		}
+	}
+}
+
+// Reads lines until every brace, paren, bracket, string and comment opened in them is closed
+func readEntry(reader lineReader) (string, error) {
+	line, err := reader.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err_obj := comp.Compile(program)
+	entry := line
 
-		if err_obj != nil {
-			printCompilerError(os.Stdout, err_obj)
-			continue
+	for incomplete(entry) {
+		line, err := reader.ReadLine(CONTINUEPROMPT)
+		if err != nil {
+			return "", err
 		}
 
-		code := comp.Bytecode()
-		constants = code.Constants
+		entry += "\n" + line
+	}
 
-		machine := vm.NewWithGlobalsStore(code, globals)
-		mac_err := machine.Run()
+	return entry, nil
+}
 
-		if mac_err != nil {
-			fmt.Fprintf(out, "executing bytecode failed:\n %s\n", mac_err)
-			continue
+// Whether src still has something open that a following line would close
+func incomplete(src string) bool {
+	depth := 0
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '"':
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			if i >= len(runes) {
+				return true
+			}
+
+		case runes[i] == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case runes[i] == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			if i+1 >= len(runes) {
+				return true
+			}
+			i++
+
+		case runes[i] == '(' || runes[i] == '[' || runes[i] == '{':
+			depth++
+
+		case runes[i] == ')' || runes[i] == ']' || runes[i] == '}':
+			depth--
+		}
+	}
+
+	return depth > 0
+}
+
+// What the REPL remembers between entries
+type session struct {
+	out     io.Writer
+	history *history
+
+	symbolTable *compiler.SymbolTable
+	constants   []Object.Object
+	globals     []Object.Object
+
+	exited bool // The code called exit
+}
+
+func newSession(out io.Writer) *session {
+	s := &session{out: out, history: loadHistory("")}
+	s.reset()
+
+	return s
+}
+
+func (s *session) reset() {
+	s.constants = []Object.Object{}
+	s.globals = make([]Object.Object, vm.GLOBALSSIZE)
+	s.symbolTable = compiler.NewSymbolTable()
+
+	for i, v := range Object.Builtins {
+		s.symbolTable.DefineBuiltin(v.Name, i)
+	}
+}
+
+// Runs a meta-command or a piece of code, false means the user asked to leave
+func (s *session) execute(entry string) bool {
+	trimmed := strings.TrimSpace(entry)
+
+	if !strings.HasPrefix(trimmed, ":") {
+		result, ok := s.eval(entry, "<stdin>")
+		if ok {
+			io.WriteString(s.out, result.Inspect()+"\n")
+		}
+		return !s.exited
+	}
+
+	name, arg, _ := strings.Cut(trimmed, " ")
+	arg = strings.TrimSpace(arg)
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "unknown command %s, :help lists the commands\n", name)
+		return true
+	}
+
+	if cmd.needsArg && arg == "" {
+		fmt.Fprintf(s.out, "usage: %s %s\n", name, cmd.usage)
+		return true
+	}
+
+	return cmd.run(s, arg) && !s.exited
+}
+
+// Parses and compiles src against the session's state, printing any errors
+func (s *session) compile(src string, filename string) (*compiler.Bytecode, bool) {
+	p := Parser.New(Lexer.New(strings.NewReader(src), filename))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParseErrors(s.out, p.Errors())
+		// continue, we dont want the REPL to exit on error
+		return nil, false
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+
+	if err := comp.Compile(program); err != nil {
+		printCompilerError(s.out, err)
+		return nil, false
+	}
+
+	return comp.Bytecode(), true
+}
+
+// Compiles and runs src, returning the last value it popped
+func (s *session) eval(src string, filename string) (Object.Object, bool) {
+	code, ok := s.compile(src, filename)
+	if !ok {
+		return nil, false
+	}
+
+	s.constants = code.Constants
+
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+
+	err := machine.Run()
+
+	// exit() leaves the REPL
+	var exit *vm.ExitError
+	if errors.As(err, &exit) {
+		s.exited = true
+		return nil, false
+	}
+
+	if err != nil {
+		fmt.Fprintf(s.out, "executing bytecode failed:\n %s\n", err)
+		return nil, false
+	}
+
+	return machine.LastPoppedStackElement(), true
+}
+
+// Tab completion: meta-commands at the start of a line, otherwise globals, builtins and keywords
+func (s *session) completions(line string, word string) []string {
+	candidates := []string{}
+
+	if strings.HasPrefix(word, ":") {
+		for name := range commands {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name)
+			}
 		}
 
-		lastPopped := machine.LastPoppedStackElement()
-		io.WriteString(out, lastPopped.Inspect())
-		io.WriteString(out, "\n")
+		sort.Strings(candidates)
+		return candidates
+	}
 
+	if word == "" {
+		return candidates
 	}
+
+	for _, symbol := range s.symbolTable.Symbols() {
+		if strings.HasPrefix(symbol.Name, word) {
+			candidates = append(candidates, symbol.Name)
+		}
+	}
+
+	for _, keyword := range Token.Keywords() {
+		if strings.HasPrefix(keyword, word) {
+			candidates = append(candidates, keyword)
+		}
+	}
+
+	sort.Strings(candidates)
+	return candidates
 }
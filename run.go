@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	Ast "github/FabioVV/comp_lang/ast"
+	"github/FabioVV/comp_lang/compiler"
+	"github/FabioVV/comp_lang/formatter"
+	lexer "github/FabioVV/comp_lang/lexer"
+	object "github/FabioVV/comp_lang/object"
+	parser "github/FabioVV/comp_lang/parser"
+	token "github/FabioVV/comp_lang/token"
+	"github/FabioVV/comp_lang/vm"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// The commands that work on a single script: run, build, disasm, tokens and ast
+
+// Every script command takes -e, so code can be given inline instead of in a file
+func evalFlag(flags *flag.FlagSet) *string {
+	return flags.String("e", "", "use this code instead of reading a file")
+}
+
+func isSet(flags *flag.FlagSet, name string) bool {
+	set := false
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
+
+/*
+Reads the script a command works on. It's the -e code if that was given, stdin if the file is - or missing
+and stdin isn't a terminal, otherwise the file named by the first argument.
+Returns the source, the name errors use for it and the arguments left for the script.
+*/
+func readScript(flags *flag.FlagSet, eval *string) ([]byte, string, []string) {
+	args := flags.Args()
+
+	if isSet(flags, "e") {
+		return []byte(*eval), "<eval>", args
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		if len(args) == 0 && isTerminal(os.Stdin) {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s needs a file, -e code or a script on stdin\n", flags.Name())
+			os.Exit(EXITUSAGE)
+		}
+
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to read stdin: %s\n", err)
+			os.Exit(EXITIO)
+		}
+
+		if len(args) > 0 {
+			args = args[1:]
+		}
+
+		return src, "<stdin>", args
+	}
+
+	path := args[0]
+
+	src, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - can't open file '%s'\nDoes the file exists? is the path correct?\n", path)
+		os.Exit(EXITIO)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to open file: %s\n", err)
+		os.Exit(EXITIO)
+	}
+
+	return src, path, args[1:]
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func parseScript(src []byte, name string) *Ast.Program {
+	p := parser.New(lexer.New(bytes.NewReader(src), name))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParseErrors(os.Stderr, p.Errors())
+		os.Exit(EXITPARSE)
+	}
+
+	return program
+}
+
+// Compiles a script, or loads it if it's a program momo build wrote
+func compileScript(src []byte, name string) *compiler.Bytecode {
+	if strings.HasSuffix(name, compiler.BYTECODESUFFIX) {
+		bytecode, err := compiler.DecodeBytecode(bytes.NewReader(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s: %s\n", name, err)
+			os.Exit(EXITIO)
+		}
+
+		return bytecode
+	}
+
+	program := parseScript(src, name)
+
+	comp := compiler.New()
+
+	if err := comp.Compile(program); err != nil {
+		printCompilerError(os.Stderr, err)
+		os.Exit(EXITCOMPILE)
+	}
+
+	for _, w := range comp.Warnings() {
+		io.WriteString(os.Stderr, w.Inspect()+"\n")
+	}
+
+	return comp.Bytecode()
+}
+
+// momo run [flags] <file | -e code | -> [args...] runs a script, whatever follows it is in args
+func runScript(arguments []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	eval := evalFlag(flags)
+	trace := flags.Bool("trace", false, "log every instruction the VM executes")
+	traceOut := flags.String("trace-out", "", "write the trace to this file instead of stderr")
+	traceFn := flags.String("trace-fn", "", "only trace instructions executed inside the function with this name")
+	profile := flags.String("profile", "", "profile the program, writing a report to this file and flamegraph stacks to <file>.folded")
+	coverage := flags.Bool("coverage", false, "record which source lines run, print a summary and write an LCOV file")
+	coverageOut := flags.String("coverage-out", "coverage.lcov", "where -coverage writes the LCOV file")
+	deny := flags.String("deny", "", "comma separated capabilities the script can't use: "+object.CAPABILITYPROC+", "+object.CAPABILITYNET)
+	flags.Parse(arguments)
+
+	src, name, args := readScript(flags, eval)
+	code := compileScript(src, name)
+
+	object.SetArgs(args)
+
+	machine := vm.NewVM(code)
+
+	if *deny != "" {
+		machine.Deny(strings.Split(*deny, ",")...)
+	}
+
+	if *trace || *traceFn != "" {
+		var traceWriter io.Writer = os.Stderr
+
+		if *traceOut != "" {
+			traceFile, err := os.Create(*traceOut)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to create trace file: %s\n", err)
+				os.Exit(EXITIO)
+			}
+
+			defer traceFile.Close()
+			traceWriter = traceFile
+		}
+
+		machine.SetTracer(vm.NewTracer(traceWriter, *traceFn))
+	}
+
+	var profiler *vm.Profiler
+
+	if *profile != "" {
+		profiler = vm.NewProfiler(vm.PROFILESAMPLEEVERY)
+		machine.SetProfiler(profiler)
+	}
+
+	var cov *vm.Coverage
+
+	if *coverage {
+		cov = vm.NewCoverage(code)
+		machine.SetCoverage(cov)
+	}
+
+	// ctrl-c cancels the program instead of killing it, so the profile and coverage still get written
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		<-interrupt
+		machine.Cancel()
+	}()
+
+	err := machine.Run()
+
+	signal.Stop(interrupt)
+
+	if profiler != nil {
+		if err := writeProfile(profiler, *profile); err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to write profile: %s\n", err)
+		}
+	}
+
+	if cov != nil {
+		if err := writeCoverage(cov, *coverageOut); err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to write coverage: %s\n", err)
+		}
+	}
+
+	var exit *vm.ExitError
+
+	if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	}
+
+	if errors.Is(err, vm.ErrCancelled) {
+		os.Exit(EXITINTERRUPT)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "executing bytecode failed:\n %s\n", err)
+		os.Exit(EXITRUNTIME)
+	}
+}
+
+// momo build [-o out] <file> compiles a script and writes the bytecode, so it can be run without compiling it again
+func runBuild(arguments []string) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	eval := evalFlag(flags)
+	output := flags.String("o", "", "where to write the compiled program (default: the file name with "+compiler.BYTECODESUFFIX+")")
+	flags.Parse(arguments)
+
+	src, name, _ := readScript(flags, eval)
+	code := compileScript(src, name)
+
+	out := *output
+	if out == "" {
+		if !strings.HasSuffix(name, formatter.SOURCESUFFIX) {
+			fmt.Fprintln(os.Stderr, "momo-pre-pre-alpha - build needs -o when the script isn't a "+formatter.SOURCESUFFIX+" file")
+			os.Exit(EXITUSAGE)
+		}
+
+		out = strings.TrimSuffix(name, formatter.SOURCESUFFIX) + compiler.BYTECODESUFFIX
+	}
+
+	var buf bytes.Buffer
+
+	if err := code.Encode(&buf); err != nil {
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - failed to encode %s: %s\n", name, err)
+		os.Exit(EXITFAILURE)
+	}
+
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+		os.Exit(EXITIO)
+	}
+}
+
+// momo disasm <file | -e code> prints the main program's bytecode followed by every function's
+func runDisasm(arguments []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	eval := evalFlag(flags)
+	flags.Parse(arguments)
+
+	src, name, _ := readScript(flags, eval)
+	code := compileScript(src, name)
+
+	fmt.Println("== main ==")
+	fmt.Print(code.Instructions.MiniDisassembler())
+
+	for i, constant := range code.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+
+		fmt.Printf("\n== constant %d, fn %s (%d params, %d locals) ==\n", i, name, fn.NumParameters, fn.NumLocals)
+		fmt.Print(fn.Instructions.MiniDisassembler())
+	}
+}
+
+// momo tokens <file | -e code> prints every token the lexer reads, one per line
+func runTokens(arguments []string) {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	eval := evalFlag(flags)
+	flags.Parse(arguments)
+
+	src, name, _ := readScript(flags, eval)
+	l := lexer.New(bytes.NewReader(src), name)
+
+	illegal := false
+
+	for {
+		pos, tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+
+		fmt.Printf("%d:%d\t%-18s %q\n", pos.Line, pos.Column, tok.Type, tok.Literal)
+
+		if tok.Type == token.ILLEGAL {
+			illegal = true
+		}
+	}
+
+	if illegal {
+		os.Exit(EXITPARSE)
+	}
+}
+
+// momo ast <file | -e code> prints the syntax tree of a script
+func runAst(arguments []string) {
+	flags := flag.NewFlagSet("ast", flag.ExitOnError)
+	eval := evalFlag(flags)
+	flags.Parse(arguments)
+
+	src, name, _ := readScript(flags, eval)
+
+	Ast.Dump(os.Stdout, parseScript(src, name))
+}
+
+/*
+momo check [paths...] parses and compiles every .momo file under paths without running anything.
+The exit code is the one of the first kind of failure found.
+*/
+func runCheck(paths []string) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := formatter.Files(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+		os.Exit(EXITIO)
+	}
+
+	status := 0
+	fail := func(code int) {
+		if status == 0 {
+			status = code
+		}
+	}
+
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "momo-pre-pre-alpha - %s\n", err)
+			fail(EXITIO)
+			continue
+		}
+
+		p := parser.New(lexer.New(bytes.NewReader(src), file))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != 0 {
+			printParseErrors(os.Stderr, p.Errors())
+			fail(EXITPARSE)
+			continue
+		}
+
+		comp := compiler.New()
+
+		if err := comp.Compile(program); err != nil {
+			printCompilerError(os.Stderr, err)
+			fail(EXITCOMPILE)
+			continue
+		}
+
+		for _, w := range comp.Warnings() {
+			io.WriteString(os.Stderr, w.Inspect()+"\n")
+		}
+	}
+
+	os.Exit(status)
+}
@@ -0,0 +1,235 @@
+package tester
+
+import (
+	"errors"
+	"fmt"
+	ast "github/FabioVV/comp_lang/ast"
+	"github/FabioVV/comp_lang/compiler"
+	lexer "github/FabioVV/comp_lang/lexer"
+	object "github/FabioVV/comp_lang/object"
+	parser "github/FabioVV/comp_lang/parser"
+	"github/FabioVV/comp_lang/vm"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const TESTFILESUFFIX = "_test.momo"
+const TESTFNPREFIX = "test_"
+
+type Result struct {
+	File     string
+	Name     string
+	Err      error // nil if the test passed
+	Duration time.Duration
+}
+
+func (r *Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Finds every *_test.momo file under paths. Paths that are files are taken as they are
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && strings.HasSuffix(d.Name(), TESTFILESUFFIX) {
+				files = append(files, p)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// The test functions of a program: top level functions named test_* in the order they were written
+func testNames(program *ast.Program) []string {
+	names := []string{}
+
+	for _, s := range program.Statements {
+		switch s := s.(type) {
+		case *ast.FunctionStatement:
+			if strings.HasPrefix(s.Name.Value, TESTFNPREFIX) {
+				names = append(names, s.Name.Value)
+			}
+
+		case *ast.VarStatement:
+			if _, ok := s.Value.(*ast.FunctionLiteral); ok && strings.HasPrefix(s.Name.Value, TESTFNPREFIX) {
+				names = append(names, s.Name.Value)
+			}
+		}
+	}
+
+	return names
+}
+
+/*
+RunFile runs every test function in the file at path. Each test runs in isolation: the top level of
+the file runs again on a brand new VM with empty globals and then the test function is called, so
+nothing a test does to global state leaks into the next one.
+*/
+func RunFile(path string) ([]*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := lexer.New(file, path)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(p.Errors()[0].Inspect())
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(v.Name, i)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, errors.New(err.Inspect())
+	}
+
+	bytecode := comp.Bytecode()
+	results := []*Result{}
+
+	for _, name := range testNames(program) {
+		symbol, ok := symbolTable.Resolve(name)
+		if !ok {
+			continue
+		}
+
+		start := time.Now()
+		err := runTest(bytecode, symbol)
+
+		results = append(results, &Result{File: path, Name: name, Err: err, Duration: time.Since(start)})
+	}
+
+	return results, nil
+}
+
+func runTest(bytecode *compiler.Bytecode, symbol compiler.Symbol) error {
+	globals := make([]object.Object, vm.GLOBALSSIZE)
+	machine := vm.NewWithGlobalsStore(bytecode, globals)
+
+	if err := machine.Run(); err != nil {
+		return fmt.Errorf("running the top level of the file failed: %w", err)
+	}
+
+	fn := globals[symbol.Index]
+
+	if cl, ok := fn.(*object.Closure); !ok || cl.Fn.NumParameters != 0 {
+		return fmt.Errorf("%s is not a function without parameters", symbol.Name)
+	}
+
+	result, err := machine.Call(fn)
+	if err != nil {
+		return err
+	}
+
+	// A test can also fail by returning an error value
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Inspect())
+	}
+
+	return nil
+}
+
+/*
+Run discovers and runs every test under paths, writing a report to out.
+It returns false if any test failed or a test file could not be compiled.
+*/
+func Run(paths []string, out io.Writer) (bool, error) {
+	files, err := Discover(paths)
+	if err != nil {
+		return false, err
+	}
+
+	passed, failed := 0, 0
+
+	for _, file := range files {
+		results, err := RunFile(file)
+
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL  %s\n", file)
+			fmt.Fprintf(out, "%s\n", indent(err.Error()))
+			continue
+		}
+
+		for _, r := range results {
+			if r.Passed() {
+				passed++
+				fmt.Fprintf(out, "PASS  %s::%s (%s)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+				continue
+			}
+
+			failed++
+			fmt.Fprintf(out, "FAIL  %s::%s (%s)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+			fmt.Fprintf(out, "%s\n", indent(describeFailure(r.Err)))
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d passed, %d failed, %d files\n", passed, failed, len(files))
+
+	return failed == 0, nil
+}
+
+func describeFailure(err error) string {
+	var assertion *vm.AssertionError
+
+	if !errors.As(err, &assertion) {
+		return err.Error()
+	}
+
+	if assertion.Expected == "" && assertion.Actual == "" {
+		return assertion.Error()
+	}
+
+	var out strings.Builder
+
+	out.WriteString(assertion.Error())
+	out.WriteString("\n--- expected\n+++ actual\n")
+	out.WriteString(Diff(assertion.Expected, assertion.Actual))
+
+	return out.String()
+}
+
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+
+	for i, line := range lines {
+		lines[i] = "      " + line
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,83 @@
+package Tests
+
+import (
+	"github/FabioVV/comp_lang/formatter"
+	"strings"
+	"testing"
+)
+
+func formatString(t *testing.T, input string) string {
+	out, err := formatter.Format(strings.NewReader(input), "Test")
+	if err != nil {
+		t.Fatalf("format error: %s", err)
+	}
+
+	return string(out)
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a=1+2*3", "var a = 1 + 2 * 3;\n"},
+		{"var b = (1+2)*3; var c = a-(b-1)", "var b = (1 + 2) * 3;\nvar c = a - (b - 1);\n"},
+		{"puts(-(-1), !true, h.a, arr[0])", "puts(-(-1), !true, h.a, arr[0]);\n"},
+		{"var h = {\"b\":2, \"a\":1}", "var h = {\"b\": 2, \"a\": 1};\n"},
+		{"fn add(x,y){return x+y}", "fn add(x, y) {\n    return x + y;\n}\n"},
+		{"fn empty() {}", "fn empty() {}\n"},
+		{"if(a){ 1 } else { loop { break } }", "if (a) {\n    1;\n} else {\n    loop {\n        break;\n    }\n}\n"},
+		{"for(var i = 0; i < 5; i++){ continue; }", "for (var i = 0; i < 5; i++) {\n    continue;\n}\n"},
+		{"typedef Point { x: 0, y: 0 }", "typedef Point {\n    x: 0,\n    y: 0\n}\n"},
+		{"#load \"utils.momo\"", "#load \"utils.momo\"\n"},
+		{"arr[0]=5\ni+=2", "arr[0] = 5;\ni += 2;\n"},
+		{"var a = 1\n\n\n\nvar b = 2", "var a = 1;\n\nvar b = 2;\n"},
+		{"var a = 1 // one\n// alone\nvar b = 2", "var a = 1; // one\n// alone\nvar b = 2;\n"},
+		{"fn f() { // why\n  1 }", "fn f() { // why\n    1;\n}\n"},
+		{"/* a * b\n   c */\nvar a = 1", "/* a * b\n   c */\nvar a = 1;\n"},
+		{"// before\n-1", "// before\n-1;\n"},
+		{"#!/usr/bin/env momo\nputs(1)", "#!/usr/bin/env momo\nputs(1);\n"},
+		{"var a = x|f(1)|m.g; var b = (x|f)+1", "var a = x | f(1) | m.g;\nvar b = (x | f) + 1;\n"},
+		{"var a = (x|f)==y; var b = x|(f==y)", "var a = x | f == y;\nvar b = x | (f == y);\n"},
+		{"var a = x+1 in s; var b = (x in s) == false", "var a = x + 1 in s;\nvar b = x in s == false;\n"},
+	}
+
+	for _, tt := range tests {
+		got := formatString(t, tt.input)
+
+		if got != tt.expected {
+			t.Errorf("wrong format for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+			continue
+		}
+
+		if again := formatString(t, got); again != got {
+			t.Errorf("formatting is not idempotent for %q.\nfirst=%q\nsecond=%q", tt.input, got, again)
+		}
+	}
+}
+
+func TestFormatKeepsMeaning(t *testing.T) {
+	input := `
+	var a = (1 + 2) * 3 - (4 - 5);
+	var f = fn(x) { if (x > 2) { x * 2 } else { -x } };
+	var h = {"k": [1, 2, 3]};
+	f(a) + h["k"][1] * f(1)
+	`
+
+	formatted := formatString(t, input)
+
+	want := vmRun(t, input)
+	got := vmRun(t, formatted)
+
+	if want != got {
+		t.Errorf("formatted program gives a different result. want=%s, got=%s\n%s", want, got, formatted)
+	}
+}
+
+func TestFormatRejectsCommentsInExpressions(t *testing.T) {
+	_, err := formatter.Format(strings.NewReader("var a = // c\n 5"), "Test")
+
+	if err == nil {
+		t.Fatalf("expected an error for a comment used as a value")
+	}
+}
@@ -75,3 +75,55 @@ func TestNextToken(t *testing.T) {
 	}
 
 }
+
+func TestShebang(t *testing.T) {
+	l := Lexer.New(strings.NewReader("#!/usr/bin/env momo\nvar a = 1;"), "Test")
+
+	pos, tok := l.NextToken()
+
+	if tok.Type != Token.VAR || pos.Line != 2 {
+		t.Fatalf("expected the first token to be VAR on line 2, got %q on line %d", tok.Type, pos.Line)
+	}
+
+	if l.Shebang != "#!/usr/bin/env momo" {
+		t.Errorf("wrong shebang. got=%q", l.Shebang)
+	}
+
+	// Anywhere else #! is not a shebang
+	l = Lexer.New(strings.NewReader("var a = 1;\n#!/usr/bin/env momo"), "Test")
+
+	for _, tok = l.NextToken(); tok.Type != Token.EOF; _, tok = l.NextToken() {
+	}
+
+	if l.Shebang != "" {
+		t.Errorf("expected no shebang after the first line, got %q", l.Shebang)
+	}
+}
+
+// Digits can be part of an identifier, just not its first character
+func TestIdentifierDigits(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Token.Token
+	}{
+		{"log10", []Token.Token{{Type: Token.IDENTIFIER, Literal: "log10"}}},
+		{"a1b2 _3", []Token.Token{{Type: Token.IDENTIFIER, Literal: "a1b2"}, {Type: Token.IDENTIFIER, Literal: "_3"}}},
+		{"x 10", []Token.Token{{Type: Token.IDENTIFIER, Literal: "x"}, {Type: Token.INT, Literal: "10"}}},
+	}
+
+	for _, tt := range tests {
+		l := Lexer.New(strings.NewReader(tt.input), "Test")
+
+		for i, want := range tt.expected {
+			_, tok := l.NextToken()
+
+			if tok.Type != want.Type || tok.Literal != want.Literal {
+				t.Errorf("%q token %d: want %s %q, got %s %q", tt.input, i, want.Type, want.Literal, tok.Type, tok.Literal)
+			}
+		}
+
+		if _, tok := l.NextToken(); tok.Type != Token.EOF {
+			t.Errorf("%q: expected EOF, got %s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
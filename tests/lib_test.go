@@ -0,0 +1,636 @@
+package Tests
+
+import (
+	"fmt"
+	object "github/FabioVV/comp_lang/object"
+	"github/FabioVV/comp_lang/vm"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Runs input with the module loaded and compares the Inspect() of the last value
+func testModule(t *testing.T, module string, tests []struct {
+	input    string
+	expected string
+}) {
+	t.Helper()
+
+	for _, tt := range tests {
+		got := vmRun(t, "#load \""+module+"\";\n"+tt.input)
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMathModule(t *testing.T) {
+	testModule(t, "math", []struct {
+		input    string
+		expected string
+	}{
+		{"math.pi", "3.141592653589793"},
+		{"math.e", "2.718281828459045"},
+		{"[math.inf, -math.inf, math.nan]", "[inf, -inf, nan]"},
+		{"math.sqrt(16)", "4.0"},
+		{"math.sqrt(2.25)", "1.5"},
+		{"math.sqrt(-1)", "ERROR: math domain error: square root of negative number -1"},
+		{"math.pow(2, 10)", "1024"},
+		{"math.pow(2, -1)", "0.5"},
+		{"math.pow(4, 0.5)", "2.0"},
+		{"math.pow(-8, 0.5)", "ERROR: math domain error: negative base -8 with fractional exponent 0.5"},
+		{"math.pow(0, -1)", "ERROR: math domain error: zero raised to negative exponent -1"},
+		{"math.pow(10, 19)", "ERROR: integer overflow: pow(10, 19) doesn't fit in an integer, use a float base"},
+		{"[math.abs(-3), math.abs(3), math.abs(-2.5)]", "[3, 3, 2.5]"},
+		{"[math.floor(2.7), math.floor(-2.1), math.ceil(2.1), math.ceil(5)]", "[2, -3, 3, 5]"},
+		{"[math.round(2.5), math.round(-2.5), math.round(2.4)]", "[3, -3, 2]"},
+		{"math.floor(math.inf)", "ERROR: math domain error: floor(inf) isn't an integer"},
+		{"[math.sin(0), math.cos(0), math.atan2(0, 1), math.exp(0)]", "[0.0, 1.0, 0.0, 1.0]"},
+		{"math.asin(2)", "ERROR: math domain error: argument to 'asin' must be between -1 and 1, got 2"},
+		{"[math.log(1), math.log2(8), math.log10(100)]", "[0.0, 3.0, 2.0]"},
+		{"math.log(0)", "ERROR: math domain error: argument to 'log' must be greater than 0, got 0"},
+		{"[math.min(3, 1.5, 2), math.max(3, 1.5, 2), math.max([1, 9, 4])]", "[1.5, 3, 9]"},
+		{"[math.max(1, 2.5), math.min(1, 2.5), math.max(2.0, 1), math.min([4.0, 4])]", "[2.5, 1, 2.0, 4.0]"},
+		{"[math.abs(-2), math.abs(-2.5), math.abs(2.0)]", "[2, 2.5, 2.0]"},
+		{"math.min()", "ERROR: 'min' needs at least one number"},
+		{"math.max(1, \"2\")", "ERROR: argument to 'max' must be INTEGER or FLOAT, got STRING"},
+		{"[math.gcd(12, 18), math.gcd(-4, 6), math.gcd(0, 0)]", "[6, 2, 0]"},
+		{"[math.lcm(4, 6), math.lcm(-3, 5), math.lcm(0, 7)]", "[12, 15, 0]"},
+		{"math.gcd(1.5, 3)", "ERROR: argument to 'gcd' must be INTEGER, got FLOAT"},
+		{"math.sqrt(\"x\")", "ERROR: argument to 'sqrt' must be INTEGER or FLOAT, got STRING"},
+		{"math.sqrt(1, 2)", "ERROR: wrong number of arguments for 'sqrt'. got=2, want=1"},
+		{"math.seed(7); var a = math.random(); var b = math.rand_int(1, 100); math.seed(7); [a == math.random(), b == math.rand_int(1, 100)]", "[true, true]"},
+		{"var r = math.rand_int(1, 3); [r > 0, r < 4]", "[true, true]"},
+		{"math.rand_int(3, 1)", "ERROR: rand_int needs min <= max, got min=3 max=1"},
+		{"math.random() < 1.0", "true"},
+		{"var f = fn() { #load \"math\"; math.sqrt(4) }; f()", "2.0"},
+	})
+}
+
+func TestStringsModule(t *testing.T) {
+	testModule(t, "strings", []struct {
+		input    string
+		expected string
+	}{
+		{`strings.split("a,b,,c", ",")`, "[a, b, , c]"},
+		{"strings.split(\"  a  b\t c\n\")", "[a, b, c]"},
+		{`strings.split("ação", "")`, "[a, ç, ã, o]"},
+		{`strings.split("a", 1)`, "ERROR: argument to 'split' must be STRING, got INTEGER"},
+		{`strings.join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`strings.join([], "-")`, ""},
+		{`strings.join(["a", 1], "-")`, "ERROR: 'join' needs an array of STRING, element 1 is INTEGER"},
+		{`strings.replace("banana", "a", "o")`, "bonono"},
+		{`strings.replace("banana", "a", "o", 2)`, "bonona"},
+		{`strings.replace("banana", "a", "o", -1)`, "ERROR: 'replace' needs a count >= 0, got -1"},
+		{"strings.trim(\" \t hi there \n\")", "hi there"},
+		{`strings.trim("xyhixy", "yx")`, "hi"},
+		{`strings.trim_left("  hi  ") + "|"`, "hi  |"},
+		{`strings.trim_right("  hi  ") + "|"`, "  hi|"},
+		{`[strings.upper("ação"), strings.lower("ÇÃO")]`, "[AÇÃO, ção]"},
+		{`[strings.contains("ação", "çã"), strings.contains("ação", "x")]`, "[true, false]"},
+		{`[strings.starts_with("ação", "aç"), strings.ends_with("ação", "ão")]`, "[true, true]"},
+		{`!strings.contains("abc", "b")`, "false"},
+		{`strings.starts_with("abc", "a") == true`, "true"},
+		{`[strings.index_of("ação", "o"), strings.index_of("ação", "z"), strings.index_of("abc", "")]`, "[3, -1, 0]"},
+		{`strings.repeat("é", 3)`, "ééé"},
+		{`strings.repeat("ab", 0)`, ""},
+		{`strings.repeat("ab", -1)`, "ERROR: 'repeat' needs a count >= 0, got -1"},
+		{`strings.pad_left("7", 3)`, "  7"},
+		{`strings.pad_left("ç", 4, "ab")`, "abaç"},
+		{`strings.pad_right("ção", 5, ".")`, "ção.."},
+		{`strings.pad_left("long", 2)`, "long"},
+		{`strings.pad_right("a", 3, "")`, "ERROR: 'pad_right' needs a non-empty pad"},
+		{"strings.lines(\"a\r\nb\n\nc\n\")", "[a, b, , c]"},
+		{`strings.lines("")`, "[]"},
+		{`strings.chars("naïve")`, "[n, a, ï, v, e]"},
+		{`strings.upper(1)`, "ERROR: argument to 'upper' must be STRING, got INTEGER"},
+		{`strings.chars()`, "ERROR: wrong number of arguments for 'chars'. got=0, want=1"},
+	})
+}
+
+func TestFsModule(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "lines.txt"), []byte("one\r\ntwo\nthree"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fs.read_file("DIR/lines.txt")`, "one\r\ntwo\nthree"},
+		{`fs.read_lines("DIR/lines.txt")`, "[one, two, three]"},
+		{`fs.read_file("DIR/missing.txt")`, "ERROR: read_file: open DIR/missing.txt: no such file or directory"},
+		{`fs.each_line("DIR/lines.txt", fn(l) { fs.append_file("DIR/seen.txt", l + ",") }); fs.read_file("DIR/seen.txt")`, "one,two,three,"},
+		{`fs.each_line("DIR/lines.txt", fn(l) { fs.append_file("DIR/first.txt", l + ","); false }); fs.read_file("DIR/first.txt")`, "one,"},
+		{`fs.each_line("DIR/lines.txt", 1)`, "ERROR: argument to 'each_line' must be a function, got INTEGER"},
+		{`fs.write_file("DIR/out.txt", "a"); fs.append_file("DIR/out.txt", "b"); fs.read_file("DIR/out.txt")`, "ab"},
+		{`fs.write_file("DIR/out.txt", "c"); fs.read_file("DIR/out.txt")`, "c"},
+		{`fs.write_file("DIR/nope/out.txt", "c")`, "ERROR: write_file: open DIR/nope/out.txt: no such file or directory"},
+		{`[fs.exists("DIR/lines.txt"), fs.exists("DIR/missing.txt")]`, "[true, false]"},
+		{`fs.mkdir("DIR/made/deep"); fs.stat("DIR/made/deep").is_dir`, "true"},
+		{`var s = fs.stat("DIR/lines.txt"); [s.size, s.is_dir, s.mtime > 0]`, "[14, false, true]"},
+		{`fs.stat("DIR/missing.txt")`, "ERROR: stat: stat DIR/missing.txt: no such file or directory"},
+		{`fs.write_file("DIR/old.txt", "x"); fs.rename("DIR/old.txt", "DIR/new.txt"); [fs.exists("DIR/old.txt"), fs.read_file("DIR/new.txt")]`, "[false, x]"},
+		{`fs.write_file("DIR/gone.txt", "x"); fs.remove("DIR/gone.txt"); fs.exists("DIR/gone.txt")`, "false"},
+		{`fs.remove("DIR/missing.txt")`, "ERROR: remove: remove DIR/missing.txt: no such file or directory"},
+		{`fs.list_dir("DIR/sub")`, "[]"},
+		{`fs.write_file("DIR/sub/b", ""); fs.write_file("DIR/sub/a", ""); fs.list_dir("DIR/sub")`, "[a, b]"},
+		{`fs.join("a", "b/", "../c.txt")`, "a/c.txt"},
+		{`[fs.base("/x/y.tar.gz"), fs.dir("/x/y.txt"), fs.ext("y.tar.gz"), fs.ext("y")]`, "[y.tar.gz, /x, .gz, ]"},
+		{`fs.abs("/x/../y")`, "/y"},
+		{`fs.read_file(1)`, "ERROR: argument to 'read_file' must be STRING, got INTEGER"},
+		{`fs.rename("a")`, "ERROR: wrong number of arguments for 'rename'. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		input := strings.ReplaceAll(tt.input, "DIR", dir)
+		expected := strings.ReplaceAll(tt.expected, "DIR", dir)
+
+		got := vmRun(t, "#load \"fs\";\n"+input)
+
+		if got != expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", input, expected, got)
+		}
+	}
+}
+
+func TestJsonModule(t *testing.T) {
+	dir := t.TempDir()
+
+	// momo strings can't hold a double quote, the documents are read from files
+	documents := map[string]string{
+		"doc.json":       `{"name": "momo", "tags": ["a", "b"], "version": 1, "ratio": 0.5, "ok": true, "none": null}`,
+		"numbers.json":   `[1, -2, 2.0, 1e3, 1.5e-3, 99999999999999999999]`,
+		"nested.json":    `{"a": {"b": [[], {}]}}`,
+		"text.json":      `"tab\tquote\" é <&>"`,
+		"truncated.json": `[1, 2`,
+		"trailing.json":  `[1] [2]`,
+		"invalid.json":   `{"a" 1}`,
+	}
+
+	for name, content := range documents {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`json.parse(fs.read_file("DIR/doc.json"))["tags"]`, "[a, b]"},
+		{`var d = json.parse(fs.read_file("DIR/doc.json")); [d["version"], d["ratio"], d["ok"], d["none"]]`, "[1, 0.5, true, null]"},
+		{`json.parse(fs.read_file("DIR/numbers.json"))`, "[1, -2, 2.0, 1000.0, 0.0015, 1e+20]"},
+		{`json.stringify(json.parse(fs.read_file("DIR/doc.json")))`, `{"name":"momo","tags":["a","b"],"version":1,"ratio":0.5,"ok":true,"none":null}`},
+		{`json.stringify({"z": 1, "a": 2, "m": {"y": 3, "b": 4}})`, `{"z":1,"a":2,"m":{"y":3,"b":4}}`},
+		{`json.stringify(json.parse(fs.read_file("DIR/numbers.json")))`, "[1,-2,2.0,1000.0,0.0015,1e+20]"},
+		{`json.stringify(json.parse(fs.read_file("DIR/nested.json")))`, `{"a":{"b":[[],{}]}}`},
+		{`fs.write_file("DIR/text.out", json.stringify(json.parse(fs.read_file("DIR/text.json"))))`, "null"},
+		{`json.stringify([1, {"a": [true]}], 2)`, "[\n  1,\n  {\n    \"a\": [\n      true\n    ]\n  }\n]"},
+		{`json.stringify([1, 2], "-")`, "[\n-1,\n-2\n]"},
+		{`json.stringify([], 4)`, "[]"},
+		{`json.parse("")`, "ERROR: parse: unexpected end of input"},
+		{`json.parse(fs.read_file("DIR/truncated.json"))`, "ERROR: parse: unexpected end of JSON input at offset 5"},
+		{`json.parse(fs.read_file("DIR/trailing.json"))`, "ERROR: parse: unexpected data after the value at offset 5"},
+		{`json.parse(fs.read_file("DIR/invalid.json"))`, "ERROR: parse: invalid character '1' after object key at offset 4"},
+		{`json.parse(1)`, "ERROR: argument to 'parse' must be STRING, got INTEGER"},
+		{`json.stringify(fn() { 1 })`, "ERROR: stringify: CLOSURE values can't be written as JSON"},
+		{`json.stringify([puts])`, "ERROR: stringify: BUILTIN values can't be written as JSON"},
+		{`json.stringify({1: 2})`, "ERROR: stringify: JSON object keys must be STRING, got INTEGER"},
+		{`json.stringify([1], 11)`, "ERROR: 'stringify' indent must be between 0 and 10 spaces, got 11"},
+		{`json.stringify([1], [])`, "ERROR: 'stringify' indent must be INTEGER or STRING, got ARRAY"},
+		{`#load "math"; json.stringify(math.nan)`, "ERROR: stringify: nan can't be written as JSON"},
+	}
+
+	for _, tt := range tests {
+		input := strings.ReplaceAll(tt.input, "DIR", dir)
+
+		got := vmRun(t, "#load \"json\";\n#load \"fs\";\n"+input)
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", input, tt.expected, got)
+		}
+	}
+
+	// Inspect shows escapes as the characters they stand for, the file has what stringify really made
+	out, err := os.ReadFile(filepath.Join(dir, "text.out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != documents["text.json"] {
+		t.Errorf("wrong stringify output for text.json. want=%q, got=%q", documents["text.json"], out)
+	}
+}
+
+func TestReModule(t *testing.T) {
+	testModule(t, "re", []struct {
+		input    string
+		expected string
+	}{
+		{`re.compile("a+b")`, "/a+b/"},
+		{`[re.match("\d+", "abc 123"), re.match("^\d+$", "abc 123"), re.match(re.compile("b"), "abc")]`, "[true, false, true]"},
+		{`re.find("(\w+)@(\w+)", "mail bob@home now")`, "[bob@home, bob, home]"},
+		{`re.find("(a)|(b)", "b")`, "[b, null, b]"},
+		{`re.find("x", "abc")`, "null"},
+		{`re.find_all("\d+", "a1 b22 c333")`, "[[1], [22], [333]]"},
+		{`re.find_all("(\w)=(\d)", "a=1, b=2, c=3", 2)`, "[[a=1, a, 1], [b=2, b, 2]]"},
+		{`re.find_all("x", "abc")`, "[]"},
+		{`var h = re.find_named("(?P<key>\w+)=(?P<value>\w*)", "name=momo"); [h["key"], h["value"]]`, "[name, momo]"},
+		{`re.find_named("(?P<key>\w+)=", "nothing here")`, "null"},
+		{`re.replace("(\w+)@(\w+)", "bob@home al@work", "$2:$1")`, "home:bob work:al"},
+		{`re.replace("(?P<n>\d+)", "a1b2", "<${n}>")`, "a<1>b<2>"},
+		{`re.replace("\d+", "a1b22", fn(m) { m[0] + m[0] })`, "a11b2222"},
+		{`re.replace("(\w)(\d)", "a1 b2", fn(m) { m[2] + m[1] })`, "1a 2b"},
+		{`re.replace("x", "abc", fn(m) { 1 })`, "abc"},
+		{`re.replace("b", "abc", fn(m) { 1 })`, "ERROR: the function given to 'replace' must return STRING, got INTEGER"},
+		{`re.replace("b", "abc", 1)`, "ERROR: argument to 'replace' must be STRING or a function, got INTEGER"},
+		{`re.split("\s*,\s*", "a , b,c")`, "[a, b, c]"},
+		{`re.split(",", "a,b,c", 2)`, "[a, b,c]"},
+		{`re.compile("(")`, "ERROR: compile: error parsing regexp: missing closing ): `(`\n Location: 'Test', line 2, column 3"},
+		{`re.match("[", "a")`, "ERROR: match: error parsing regexp: missing closing ]: `[`\n Location: 'Test', line 2, column 3"},
+		{`re.match(1, "a")`, "ERROR: argument to 'match' must be REGEX or STRING, got INTEGER"},
+		{`re.compile(re.compile("a"))`, "ERROR: argument to 'compile' must be STRING, got REGEX"},
+		{`re.find("a")`, "ERROR: wrong number of arguments for 'find'. got=1, want=2"},
+	})
+}
+
+func TestTimeModule(t *testing.T) {
+	testModule(t, "time", []struct {
+		input    string
+		expected string
+	}{
+		{`time.parse("2024-01-31T10:00:00Z")`, "2024-01-31T10:00:00Z"},
+		{`time.parse("2024-01-31T10:00:00.5+02:00")`, "2024-01-31T10:00:00.5+02:00"},
+		{`time.parse("31/01/2024 7pm", "02/01/2006 3pm")`, "2024-01-31T19:00:00Z"},
+		{`time.parse("2024-13-01", time.iso_date)`, `ERROR: parse: parsing time "2024-13-01": month out of range`},
+		{`var t = time.parse("2024-01-31T10:00:00Z"); [time.format(t, time.iso_date), time.format(t, time.datetime), time.format(t, time.clock)]`, "[2024-01-31, 2024-01-31 10:00:00, 10:00:00]"},
+		{`time.format(time.parse("2024-01-31T10:00:00Z"), "Mon Jan 2")`, "Wed Jan 31"},
+		{`time.add(time.parse("2024-01-31T10:00:00Z"), 90 * time.minute)`, "2024-01-31T11:30:00Z"},
+		{`time.add(time.parse("2024-01-31T10:00:00Z"), -1.5)`, "2024-01-31T09:59:59.9985Z"},
+		{`time.add_date(time.parse("2024-01-31T10:00:00Z"), 1, 1, -1)`, "2025-03-02T10:00:00Z"},
+		{`var t = time.parse("2024-01-31T10:00:00Z"); time.diff(time.add(t, time.day), t) == 86400000`, "true"},
+		{`[time.unix(time.from_unix(86400)), time.unix_ms(time.parse("1970-01-01T00:00:01Z"))]`, "[86400, 1000]"},
+		{`var f = time.fields(time.parse("2024-01-31T10:20:30Z")); [f["year"], f["month"], f["day"], f["hour"], f["minute"], f["second"], f["weekday"]]`, "[2024, 1, 31, 10, 20, 30, 3]"},
+		{`var s = time.now(); time.sleep(20); var e = time.elapsed(s); [e > 19, e < 5000]`, "[true, true]"},
+		{`time.sleep(0)`, "null"},
+		{`time.unix() > 1700000000`, "true"},
+		{`time.add(1, 2)`, "ERROR: argument to 'add' must be TIME, got INTEGER"},
+		{`time.sleep("1")`, "ERROR: argument to 'sleep' must be INTEGER or FLOAT milliseconds, got STRING"},
+		{`time.add(time.now(), 1e300)`, "ERROR: 'add' duration 1e+300 is out of range"},
+		{`time.now(1)`, "ERROR: wrong number of arguments for 'now'. got=1, want=0"},
+	})
+}
+
+func TestProcModule(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var r = proc.run("echo", ["hello", "world"]); [r["stdout"], r["stderr"], r["code"]]`, "[hello world\n, , 0]"},
+		{`proc.run("sh", ["-c", "echo oops >&2; exit 3"])["code"]`, "3"},
+		{`proc.run("sh", ["-c", "echo oops >&2; exit 3"])["stderr"]`, "oops\n"},
+		{`proc.run("pwd", [], {"dir": "DIR"})["stdout"]`, "DIR\n"},
+		{`proc.run("sh", ["-c", "echo $MOMO_PROC_TEST"], {"env": {"MOMO_PROC_TEST": "set"}})["stdout"]`, "set\n"},
+		{`proc.run("tr", ["a-z", "A-Z"], {"stdin": "piped in"})["stdout"]`, "PIPED IN"},
+		{`proc.run("sleep", ["5"], {"timeout": 50})`, "ERROR: run: /SLEEP timed out after 50ms"},
+		{`proc.run("momo-no-such-program")`, `ERROR: run: exec: "momo-no-such-program": executable file not found in $PATH`},
+		{`proc.run("echo", [1])`, "ERROR: 'run' needs an array of STRING arguments, argument 0 is INTEGER"},
+		{`proc.run("echo", "a")`, "ERROR: arguments to 'run' must be an ARRAY, got STRING"},
+		{`proc.run("echo", [], {"shell": true})`, "ERROR: unknown option 'shell' for 'run'"},
+		{`proc.run("echo", [], {"timeout": 0})`, "ERROR: 'run' option timeout must be a positive INTEGER of milliseconds, got 0"},
+		{`proc.run("echo", [], {"env": {"A": 1}})`, "ERROR: 'run' option env must map STRING to STRING, got STRING: INTEGER"},
+		{`#load "fs"; proc.stream("sh", fn(line, source) { fs.append_file("DIR/out.txt", source + ":" + line + ",") }, ["-c", "echo a; echo b"])`, "0"},
+		{`#load "fs"; fs.read_file("DIR/out.txt")`, "stdout:a,stdout:b,"},
+		{`proc.stream("sh", fn(line, source) { false }, ["-c", "echo a; sleep 5; echo b"])`, "-1"},
+		{`proc.stream("sh", fn(line, source) { 1 }, ["-c", "exit 4"])`, "4"},
+		{`proc.stream("echo", 1)`, "ERROR: argument to 'stream' must be a function, got INTEGER"},
+	}
+
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("no sleep program to test with")
+	}
+
+	for _, tt := range tests {
+		input := strings.ReplaceAll(tt.input, "DIR", dir)
+		expected := strings.ReplaceAll(strings.ReplaceAll(tt.expected, "DIR", dir), "/SLEEP", sleep)
+
+		got := vmRun(t, "#load \"proc\";\n"+input)
+
+		if got != expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", input, expected, got)
+		}
+	}
+}
+
+func TestProcCapability(t *testing.T) {
+	machine := vm.NewVM(compileInput(t, `#load "proc"; [proc.run("echo"), proc.stream("echo", puts)]`))
+	machine.Deny(object.CAPABILITYPROC)
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := "[ERROR: run: running programs isn't allowed here, ERROR: stream: running programs isn't allowed here]"
+
+	if got := machine.LastPoppedStackElement().Inspect(); got != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestHttpModule(t *testing.T) {
+	// Each case serves handler on a port of its own and makes its requests from ready, addresses show up as ADDR
+	handler := `#load "http";
+	#load "strings";
+	#load "time";
+	var handler = fn(req) {
+		if (strings.starts_with(req["path"], "/echo")) {
+			return {"status": 201, "headers": {"X-Method": req["method"], "X-Name": req["query"]["name"]}, "body": req["body"]}
+		}
+		if (strings.starts_with(req["path"], "/header")) {
+			return req["headers"]["x-token"]
+		}
+		if (strings.starts_with(req["path"], "/missing")) {
+			return {"status": 404, "body": "not here"}
+		}
+		if (strings.starts_with(req["path"], "/slow")) {
+			time.sleep(500)
+		}
+		if (strings.starts_with(req["path"], "/fail")) {
+			return "a" - 1
+		}
+		if (strings.starts_with(req["path"], "/bad")) {
+			return {"bogus": 1}
+		}
+		"plain"
+	}
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { http.get("http://" + addr + "/")["body"] })`, "plain"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) {
+			var r = http.post("http://" + addr + "/echo?name=momo", "sent");
+			[r["status"], r["headers"]["x-method"], r["headers"]["x-name"], r["body"]]
+		})`, "[201, POST, momo, sent]"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) {
+			var r = http.request("put", "http://" + addr + "/echo?name=x", {"body": "put body"});
+			[r["headers"]["x-method"], r["body"]]
+		})`, "[PUT, put body]"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { http.get("http://" + addr + "/header", {"headers": {"X-Token": "secret"}})["body"] })`, "secret"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { var r = http.get("http://" + addr + "/missing"); [r["status"], r["body"]] })`, "[404, not here]"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { http.get("http://" + addr + "/fail")["status"] })`, "500"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { http.get("http://" + addr + "/bad")["body"] })`, "unknown response field 'bogus'\n"},
+		{`http.serve("127.0.0.1:0", handler, fn(addr) { http.get("http://" + addr + "/slow", {"timeout": 50}) })`, "ERROR: get: GET http://ADDR/slow timed out after 50ms"},
+		{`http.serve("127.0.0.1:0", fn(req) { exit(3) }, fn(addr) { http.get("http://" + addr + "/") })`, "exit status 3"},
+		{`http.get("http://127.0.0.1:0/", {"retries": 3})`, "ERROR: unknown option 'retries' for 'get'"},
+		{`http.get("http://127.0.0.1:0/", {"headers": {"A": 1}})`, "ERROR: 'get' headers must map STRING to STRING, got STRING: INTEGER"},
+		{`http.post("http://127.0.0.1:0/")`, "ERROR: wrong number of arguments for 'post'. got=1, want=2 or 3"},
+		{`http.serve("127.0.0.1:0", 1)`, "ERROR: argument to 'serve' must be a function, got INTEGER"},
+		{`http.serve("nowhere", handler)`, "ERROR: serve: listen tcp: address nowhere: missing port in address"},
+	}
+
+	addr := regexp.MustCompile(`127\.0\.0\.1:\d+`)
+
+	for _, tt := range tests {
+		machine := vm.NewVM(compileInput(t, handler+tt.input))
+
+		var got string
+
+		if err := machine.Run(); err != nil {
+			got = err.Error()
+		} else {
+			got = addr.ReplaceAllString(machine.LastPoppedStackElement().Inspect(), "ADDR")
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// Requests handled at the same time each run on a VM of their own, so deep calls in one don't clobber another
+func TestHttpConcurrentRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no port to test with: %s", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	machine := vm.NewVM(compileInput(t, `#load "http";
+	var deep = fn(s, n) { if (n < 1) { return s } deep(s, n - 1) }
+	http.serve("`+addr+`", fn(req) { deep(req["body"] + req["query"]["id"], 200) })`))
+
+	finished := make(chan error, 1)
+	go func() { finished <- machine.Run() }()
+
+	// Wait for the server to come up
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if i == 100 {
+			t.Fatalf("the server didn't start: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var requests sync.WaitGroup
+
+	for i := 0; i < 32; i++ {
+		requests.Add(1)
+
+		go func(i int) {
+			defer requests.Done()
+
+			resp, err := http.Post(fmt.Sprintf("http://%s/?id=%d", addr, i), "text/plain", strings.NewReader("request "))
+			if err != nil {
+				t.Errorf("request %d failed: %s", i, err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if expected := fmt.Sprintf("request %d", i); string(body) != expected {
+				t.Errorf("wrong response for request %d. want=%q, got=%q", i, expected, body)
+			}
+		}(i)
+	}
+
+	requests.Wait()
+	machine.Cancel()
+
+	if err := <-finished; err != vm.ErrCancelled {
+		t.Errorf("serve should stop when the VM is cancelled, got=%v", err)
+	}
+}
+
+/*
+Requests are handled at the same time, each on its own copy of the globals: they overlap in time, a handler
+adding to a global set only sees what it added, and a handler can make a request to its own server.
+Run with -race to check they don't share anything.
+*/
+func TestHttpIsolatedRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("no port to test with: %s", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	machine := vm.NewVM(compileInput(t, `#load "http"; #load "json"; #load "time";
+	var seen = set("main");
+	var deep = fn(s, n) { if (n < 1) { return s } deep(s, n - 1) }
+	var handle = fn(req) {
+		if (req["path"] == "/inner") { return "inner" }
+		if (req["path"] == "/outer") { return http.get("http://`+addr+`/inner")["body"] }
+		var id = req["query"]["id"];
+		seen.add(id);
+		time.sleep(200);
+		json.stringify([deep(id, 100), seen.values()])
+	}
+	http.serve("`+addr+`", handle)`))
+
+	finished := make(chan error, 1)
+	go func() { finished <- machine.Run() }()
+
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if i == 100 {
+			t.Fatalf("the server didn't start: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	get := func(path string) string {
+		client := http.Client{Timeout: 5 * time.Second}
+
+		resp, err := client.Get("http://" + addr + path)
+		if err != nil {
+			t.Errorf("request to %s failed: %s", path, err)
+			return ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	var requests sync.WaitGroup
+	start := time.Now()
+
+	for i := 0; i < 8; i++ {
+		requests.Add(1)
+
+		go func(i int) {
+			defer requests.Done()
+
+			id := fmt.Sprint(i)
+			expected := fmt.Sprintf(`[%q,[%q,"main"]]`, id, id)
+
+			if got := get("/?id=" + id); got != expected {
+				t.Errorf("wrong response for request %d. want=%s, got=%s", i, expected, got)
+			}
+		}(i)
+	}
+
+	requests.Wait()
+
+	// Handled one after the other the eight requests would take at least 1.6s
+	if elapsed := time.Since(start); elapsed > 1200*time.Millisecond {
+		t.Errorf("requests didn't overlap, they took %s", elapsed)
+	}
+
+	if got := get("/outer"); got != "inner" {
+		t.Errorf("a handler calling its own server should get the inner response, got %q", got)
+	}
+
+	machine.Cancel()
+
+	if err := <-finished; err != vm.ErrCancelled {
+		t.Errorf("serve should stop when the VM is cancelled, got=%v", err)
+	}
+}
+
+func TestHttpCapability(t *testing.T) {
+	machine := vm.NewVM(compileInput(t, `#load "http"; [http.get("http://127.0.0.1:0/"), http.serve("127.0.0.1:0", puts)]`))
+	machine.Deny(object.CAPABILITYNET)
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := "[ERROR: get: using the network isn't allowed here, ERROR: serve: using the network isn't allowed here]"
+
+	if got := machine.LastPoppedStackElement().Inspect(); got != expected {
+		t.Errorf("wrong result. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestEncodingModule(t *testing.T) {
+	testModule(t, "encoding", []struct {
+		input    string
+		expected string
+	}{
+		{`encoding.bytes("hé")`, "[104, 195, 169]"},
+		{`encoding.from_bytes([104, 105])`, "hi"},
+		{`encoding.from_bytes([104, 256])`, "ERROR: 'from_bytes' needs an array of bytes from 0 to 255, element 1 is 256"},
+		{`encoding.base64_encode("hi?>")`, "aGk/Pg=="},
+		{`encoding.base64url_encode("hi?>")`, "aGk_Pg=="},
+		{`encoding.base64_decode("aGk/Pg==")`, "hi?>"},
+		{`encoding.base64url_decode(encoding.base64url_encode([0, 255, 128]))`, "\x00\xff\x80"},
+		{`encoding.base64_decode("*")`, "ERROR: base64_decode: illegal base64 data at input byte 0"},
+		{`encoding.hex_encode([0, 15, 255])`, "000fff"},
+		{`encoding.bytes(encoding.hex_decode("000fff"))`, "[0, 15, 255]"},
+		{`encoding.hex_decode("zz")`, "ERROR: hex_decode: encoding/hex: invalid byte: U+007A 'z'"},
+		{`encoding.md5("")`, "d41d8cd98f00b204e9800998ecf8427e"},
+		{`encoding.sha1("abc")`, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{`encoding.sha256("abc")`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`encoding.sha512("abc")`, "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{`encoding.sha256(encoding.bytes("abc"))`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{`encoding.hmac("sha256", "key", "The quick brown fox jumps over the lazy dog")`, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{`encoding.hmac("md4", "key", "")`, "ERROR: unknown 'hmac' algorithm 'md4', use md5, sha1, sha256 or sha512"},
+		{`encoding.crc32("hello")`, "907060870"},
+		{`encoding.url_escape("a b&c=d/é")`, "a+b%26c%3Dd%2F%C3%A9"},
+		{`encoding.url_unescape("a+b%26c")`, "a b&c"},
+		{`encoding.url_unescape("%zz")`, `ERROR: url_unescape: invalid URL escape "%zz"`},
+		{`encoding.query_encode({"b": "x y", "a": ["1", "2"]})`, "a=1&a=2&b=x+y"},
+		{`encoding.query_encode({"a": 1})`, "ERROR: 'query_encode' values must be STRING or an ARRAY of them, got INTEGER for a"},
+		{`var q = encoding.query_decode("a=1&a=2&b=x+y"); [q["a"], q["b"]]`, "[1, x y]"},
+		{`var q = encoding.query_decode_all("a=1&a=2&b=x+y"); [q["a"], q["b"]]`, "[[1, 2], [x y]]"},
+		{`encoding.query_decode_all("")`, "{}"},
+		{`encoding.query_decode("a=%zz")`, `ERROR: query_decode: invalid URL escape "%zz"`},
+		{`encoding.sha256(1)`, "ERROR: argument to 'sha256' must be STRING or an ARRAY of bytes, got INTEGER"},
+		{`encoding.crc32()`, "ERROR: wrong number of arguments for 'crc32'. got=0, want=1"},
+	})
+}
@@ -0,0 +1,63 @@
+package Tests
+
+import (
+	"fmt"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	"github/FabioVV/comp_lang/linter"
+	Parser "github/FabioVV/comp_lang/parser"
+	"strings"
+	"testing"
+)
+
+func lintInput(t *testing.T, input string) []*linter.Warning {
+	l := Lexer.New(strings.NewReader(input), "Test")
+	p := Parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return linter.New("Test").Lint(program)
+}
+
+func TestLinter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // check:line of every warning
+	}{
+		{"fn f(a, b) { var c = 1; b }", []string{"unused:1", "unused:1"}},
+		{"fn f(_a) { var _b = 1; 1 }", []string{}},
+		{"var x = 1; fn f() { var x = 2; x }\nx", []string{"shadow:1"}},
+		{"var len = 1; len", []string{"shadow:1"}},
+		{"fn f(len) { len }", []string{"shadow:1"}},
+		{"fn f() {\n return 1;\n puts(2);\n puts(3)\n}", []string{"unreachable:3"}},
+		{"loop {\n break;\n // fine\n}", []string{}},
+		{"fn f() { y = 1 }", []string{"undeclared:1"}},
+		{"var y = 0; fn f() { y = 1; y += 1 }", []string{}},
+		{"var h = {\"a\": 1, \"b\": 2, \"a\": 3}; h", []string{"duplicate-key:1"}},
+		{"var h = {1: 1, 0x1: 2, true: 1, false: 2}; h", []string{"duplicate-key:1"}},
+		{"if (1 < 2) { 1 }", []string{"constant-condition:1"}},
+		{"var a = 1; if (a < 2) { 1 }", []string{}},
+		{"var f = fn(n) { if (n < 1) { 0 } else { f(n - 1) } }\nf(3)", []string{}},
+		{"fn f(a) {\n var b = 1 // lint:ignore unused\n a\n}", []string{}},
+		{"fn f(a) {\n // lint:ignore\n var b = 1\n var c = 1\n a\n}", []string{"unused:4"}},
+		{"fn f(a) {\n var b = 1 // lint:ignore shadow\n a\n}", []string{"unused:2"}},
+		{"#load \"math\"\nmath.sqrt(2)", []string{}},
+		{"fn f() {\n #load \"math\"\n 1\n}", []string{"unused:2"}},
+		{"var a = 1\nvar _b = 2\nfn f() { 1 }\n#load \"math\"", []string{"unused:1", "unused:4"}},
+		{"var a = 1\nvar a = 2\na", []string{"unused:1"}},
+		{"// lint:ignore\nvar len = 1 // lint:ignore unreachable", []string{}},
+		{"// lint:ignore shadow\nvar len = 1 // lint:ignore", []string{}},
+	}
+
+	for _, tt := range tests {
+		warnings := lintInput(t, tt.input)
+		got := []string{}
+
+		for _, w := range warnings {
+			got = append(got, fmt.Sprintf("%s:%d", w.Check, w.Line))
+		}
+
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("wrong warnings for %q.\nwant=%v\ngot=%v", tt.input, tt.expected, warnings)
+		}
+	}
+}
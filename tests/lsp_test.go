@@ -0,0 +1,198 @@
+package Tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github/FabioVV/comp_lang/lsp"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type lspMessage struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+func lspFrame(t *testing.T, id int, method string, params interface{}) string {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		msg["id"] = id
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func readLSPMessages(t *testing.T, out []byte) []lspMessage {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(out)))
+	messages := []lspMessage{}
+
+	for {
+		header, err := r.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("bad header: %s", err)
+		}
+
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r.R, body); err != nil {
+			t.Fatal(err)
+		}
+
+		var msg lspMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+
+		messages = append(messages, msg)
+	}
+}
+
+func TestLanguageServer(t *testing.T) {
+	dir := t.TempDir()
+
+	util := "fn double(x) {\n    x * 2\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "util.momo"), []byte(util), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := strings.Join([]string{
+		`#load "util.momo"`,
+		`var count = 10;`,
+		`fn add(a, b) {`,
+		`    var total = a + b;`,
+		`    total + count`,
+		`}`,
+		`add(double(count), 1)`,
+		`var broken = undefined_name;`,
+	}, "\n")
+
+	path := filepath.Join(dir, "main.momo")
+	uri := "file://" + filepath.ToSlash(path)
+	doc := map[string]interface{}{"uri": uri}
+
+	at := func(line, character int) map[string]interface{} {
+		return map[string]interface{}{"textDocument": doc, "position": map[string]int{"line": line, "character": character}}
+	}
+
+	input := lspFrame(t, 1, "initialize", map[string]interface{}{}) +
+		lspFrame(t, 0, "initialized", map[string]interface{}{}) +
+		lspFrame(t, 0, "textDocument/didOpen", map[string]interface{}{"textDocument": map[string]string{"uri": uri, "text": text}}) +
+		lspFrame(t, 2, "textDocument/hover", at(4, 13)) +
+		lspFrame(t, 3, "textDocument/definition", at(6, 5)) +
+		lspFrame(t, 4, "textDocument/definition", at(0, 3)) +
+		lspFrame(t, 5, "textDocument/documentSymbol", map[string]interface{}{"textDocument": doc}) +
+		lspFrame(t, 6, "textDocument/completion", at(4, 4)) +
+		lspFrame(t, 7, "shutdown", nil) +
+		lspFrame(t, 0, "exit", nil)
+
+	var out bytes.Buffer
+
+	if err := lsp.NewServer(strings.NewReader(input), &out).Run(); err != nil {
+		t.Fatalf("server failed: %s", err)
+	}
+
+	results := map[int]string{}
+	diagnostics := ""
+
+	for _, msg := range readLSPMessages(t, out.Bytes()) {
+		if msg.ID != nil {
+			results[*msg.ID] = string(msg.Result)
+		} else if msg.Method == "textDocument/publishDiagnostics" {
+			diagnostics = string(msg.Params)
+		}
+	}
+
+	expectations := []struct {
+		what     string
+		got      string
+		contains []string
+	}{
+		{"initialize", results[1], []string{`"hoverProvider":true`, `"completionProvider"`}},
+		{"diagnostics", diagnostics, []string{`undefined_name`, `"line":7`}},
+		{"hover", results[2], []string{`var count`, `global variable, type INTEGER`}},
+		{"definition of double", results[3], []string{`util.momo`, `"start":{"line":0,"character":3}`}},
+		{"definition of #load", results[4], []string{`util.momo`}},
+		{"document symbols", results[5], []string{`"name":"add"`, `"name":"total"`, `"end":{"line":5,"character":1}`}},
+		{"completion", results[6], []string{`"label":"total"`, `"label":"count"`, `"label":"double"`, `"label":"len"`, `"label":"typedef"`}},
+	}
+
+	for _, e := range expectations {
+		for _, want := range e.contains {
+			if !strings.Contains(e.got, want) {
+				t.Errorf("%s: expected %s in\n%s", e.what, want, e.got)
+			}
+		}
+	}
+}
+
+func TestLanguageServerMalformedMessages(t *testing.T) {
+	raw := func(body string) string {
+		return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+
+	input := raw(`{"jsonrpc":"2.0","id":1,"method":`) +
+		raw(`{"jsonrpc":"2.0","id":2,"method":42}`) +
+		raw(`[1, 2, 3]`) +
+		lspFrame(t, 3, "initialize", map[string]interface{}{}) +
+		lspFrame(t, 4, "shutdown", nil) +
+		lspFrame(t, 0, "exit", nil)
+
+	var out bytes.Buffer
+
+	if err := lsp.NewServer(strings.NewReader(input), &out).Run(); err != nil {
+		t.Fatalf("server failed: %s", err)
+	}
+
+	messages := readLSPMessages(t, out.Bytes())
+	if len(messages) != 5 {
+		t.Fatalf("expected 5 responses, got %d", len(messages))
+	}
+
+	errorCodes := []struct {
+		id   *int
+		code int
+	}{
+		{nil, lsp.PARSEERROR},
+		{intPtr(2), lsp.INVALIDREQUEST},
+		{nil, lsp.INVALIDREQUEST},
+	}
+
+	for i, want := range errorCodes {
+		msg := messages[i]
+		if msg.Error == nil || msg.Error.Code != want.code {
+			t.Errorf("message %d: expected error %d, got %+v", i, want.code, msg.Error)
+		}
+
+		if (msg.ID == nil) != (want.id == nil) || (msg.ID != nil && *msg.ID != *want.id) {
+			t.Errorf("message %d: wrong id %v", i, msg.ID)
+		}
+	}
+
+	if messages[3].ID == nil || *messages[3].ID != 3 || !strings.Contains(string(messages[3].Result), "capabilities") {
+		t.Errorf("server stopped answering after malformed messages: %+v", messages[3])
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
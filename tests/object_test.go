@@ -0,0 +1,324 @@
+package Tests
+
+import (
+	"fmt"
+	object "github/FabioVV/comp_lang/object"
+	"math"
+	"testing"
+)
+
+// A key whose HashKey is always the same, so any two of them collide
+type collidingKey struct {
+	name string
+}
+
+func (k *collidingKey) Type() object.ObjectType { return "COLLIDING" }
+func (k *collidingKey) Inspect() string         { return k.name }
+
+func (k *collidingKey) HashKey() object.HashKey {
+	return object.HashKey{Type: k.Type(), Value: 42}
+}
+
+func (k *collidingKey) SameKey(other object.Object) bool {
+	o, ok := other.(*collidingKey)
+	return ok && o.name == k.name
+}
+
+func TestHashCollisions(t *testing.T) {
+	hash := object.NewHash()
+
+	a, b, c := &collidingKey{"a"}, &collidingKey{"b"}, &collidingKey{"c"}
+
+	hash.Set(a, &object.Integer{Value: 1})
+	hash.Set(b, &object.Integer{Value: 2})
+	hash.Set(c, &object.Integer{Value: 3})
+	hash.Set(&collidingKey{"b"}, &object.Integer{Value: 20})
+
+	if hash.Len() != 3 {
+		t.Fatalf("colliding keys must not overwrite each other, got %d pairs: %s", hash.Len(), hash.Inspect())
+	}
+
+	for key, expected := range map[string]int64{"a": 1, "b": 20, "c": 3} {
+		value, ok := hash.Get(&collidingKey{key})
+		if !ok {
+			t.Errorf("key %s is missing", key)
+			continue
+		}
+
+		if value.(*object.Integer).Value != expected {
+			t.Errorf("wrong value for %s. want=%d, got=%s", key, expected, value.Inspect())
+		}
+	}
+
+	if _, ok := hash.Get(&collidingKey{"d"}); ok {
+		t.Errorf("a key that was never set shouldn't be found just because its HashKey is")
+	}
+
+	if got := hash.Inspect(); got != "{a: 1, b: 20, c: 3}" {
+		t.Errorf("colliding keys should keep their order, got %s", got)
+	}
+}
+
+func TestSetCollisions(t *testing.T) {
+	set := object.NewSet()
+
+	set.Add(&collidingKey{"a"})
+	set.Add(&collidingKey{"b"})
+	set.Add(&collidingKey{"a"})
+
+	if set.Len() != 2 || !set.Has(&collidingKey{"a"}) || !set.Has(&collidingKey{"b"}) || set.Has(&collidingKey{"c"}) {
+		t.Fatalf("wrong set with colliding elements: %s", set.Inspect())
+	}
+
+	set.Remove(&collidingKey{"a"})
+
+	if set.Len() != 1 || set.Has(&collidingKey{"a"}) || !set.Has(&collidingKey{"b"}) {
+		t.Errorf("removing a colliding element should leave the other, got %s", set.Inspect())
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	s := &object.String{Value: "momo"}
+
+	first := s.HashKey()
+
+	if second := s.HashKey(); second != first {
+		t.Errorf("a string's hash key changed between calls, %v then %v", first, second)
+	}
+
+	if fresh := (&object.String{Value: "momo"}).HashKey(); fresh != first {
+		t.Errorf("equal strings have different hash keys, %v and %v", first, fresh)
+	}
+
+	if other := (&object.String{Value: "nomo"}).HashKey(); other == first {
+		t.Errorf("different strings have the same hash key %v", first)
+	}
+}
+
+func benchmarkHash(size int) (*object.Hash, []*object.String) {
+	hash := object.NewHash()
+	keys := make([]*object.String, size)
+
+	for i := range keys {
+		keys[i] = &object.String{Value: fmt.Sprintf("a fairly long key so hashing it isn't free, number %d", i)}
+		hash.Set(keys[i], &object.Integer{Value: int64(i)})
+	}
+
+	return hash, keys
+}
+
+// Looking up with the strings that are already keys, their hashes are cached after the first round
+func BenchmarkHashGetCached(b *testing.B) {
+	hash, keys := benchmarkHash(1000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		hash.Get(keys[i%len(keys)])
+	}
+}
+
+// Looking up with new strings every time, each one has to be hashed, like the cost of every lookup before caching
+func BenchmarkHashGetUncached(b *testing.B) {
+	hash, keys := benchmarkHash(1000)
+
+	lookups := make([]*object.String, b.N)
+	for i := range lookups {
+		lookups[i] = &object.String{Value: keys[i%len(keys)].Value}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		hash.Get(lookups[i])
+	}
+}
+
+func BenchmarkHashSet(b *testing.B) {
+	_, keys := benchmarkHash(1000)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		hash := object.NewHash()
+
+		for _, key := range keys {
+			hash.Set(key, key)
+		}
+	}
+}
+
+func typeDef(name string, attributes ...object.Object) *object.TypeDef {
+	hash := object.NewHash()
+
+	for i := 0; i < len(attributes); i += 2 {
+		hash.Set(attributes[i].(object.Hashable), attributes[i+1])
+	}
+
+	return &object.TypeDef{Name: name, Attributes: hash}
+}
+
+// Typedefs aren't compiled yet, so their keys are only tested here
+func TestTypeDefKeys(t *testing.T) {
+	x, y := &object.String{Value: "x"}, &object.String{Value: "y"}
+	one, two := &object.Integer{Value: 1}, &object.Float{Value: 2.0}
+
+	point := typeDef("Point", x, one, y, two)
+
+	hash := object.NewHash()
+
+	key, ok := object.AsKey(point)
+	if !ok {
+		t.Fatalf("a typedef of hashable attributes should be a key")
+	}
+
+	hash.Set(key, &object.String{Value: "origin"})
+
+	// The same attributes in another order, with 2 as an integer, are the same key
+	if _, ok := hash.Get(typeDef("Point", y, &object.Integer{Value: 2}, x, one)); !ok {
+		t.Errorf("an equal typedef should find the key %s", point.Inspect())
+	}
+
+	for _, other := range []*object.TypeDef{
+		typeDef("Vector", x, one, y, two),
+		typeDef("Point", x, one),
+		typeDef("Point", x, one, y, one),
+	} {
+		if _, ok := hash.Get(other); ok {
+			t.Errorf("%s shouldn't be the same key as %s", other.Inspect(), point.Inspect())
+		}
+	}
+
+	if _, ok := object.AsKey(typeDef("Point", x, &object.Array{})); ok {
+		t.Errorf("a typedef with an array attribute shouldn't be a key")
+	}
+
+	if _, ok := object.AsKey(typeDef("Point", x, &object.Tuple{Elements: []object.Object{&object.Array{}}})); ok {
+		t.Errorf("a typedef with a tuple holding an array shouldn't be a key")
+	}
+}
+
+// Typedefs inside tuples and tuples inside typedefs, looked up with equal values built separately
+func TestCompositeTypeDefKeys(t *testing.T) {
+	name := &object.String{Value: "name"}
+	at := &object.String{Value: "at"}
+
+	place := func(label string, x int64, y float64) *object.TypeDef {
+		coords := &object.Tuple{Elements: []object.Object{&object.Integer{Value: x}, &object.Float{Value: y}}}
+		return typeDef("Place", name, &object.String{Value: label}, at, coords)
+	}
+
+	route := func(from *object.TypeDef, to *object.TypeDef) *object.Tuple {
+		return &object.Tuple{Elements: []object.Object{from, to}}
+	}
+
+	hash := object.NewHash()
+	set := object.NewSet()
+
+	for i, key := range []object.Object{
+		place("home", 1, 2),
+		route(place("home", 1, 2), place("work", 3, 4.5)),
+		typeDef("Trip", name, &object.String{Value: "daily"}, at, route(place("home", 1, 2), place("work", 3, 4.5))),
+	} {
+		hashable, ok := object.AsKey(key)
+		if !ok {
+			t.Fatalf("%s should be a key", key.Inspect())
+		}
+
+		hash.Set(hashable, &object.Integer{Value: int64(i)})
+
+		if err := set.Add(key); err != nil {
+			t.Fatalf("%s should be a set element: %s", key.Inspect(), err.Message)
+		}
+	}
+
+	lookups := []struct {
+		key      object.Object
+		expected int64
+	}{
+		// 2 and 2.0 are the same key, so an integer y finds a float one
+		{place("home", 1, 2.0), 0},
+		{route(place("home", 1, 2), place("work", 3, 4.5)), 1},
+		{typeDef("Trip", at, route(place("home", 1, 2), place("work", 3, 4.5)), name, &object.String{Value: "daily"}), 2},
+	}
+
+	for _, tt := range lookups {
+		value, ok := hash.Get(tt.key.(object.Hashable))
+		if !ok {
+			t.Errorf("%s wasn't found", tt.key.Inspect())
+			continue
+		}
+
+		if value.(*object.Integer).Value != tt.expected {
+			t.Errorf("wrong value for %s. want=%d, got=%s", tt.key.Inspect(), tt.expected, value.Inspect())
+		}
+
+		if !set.Has(tt.key) {
+			t.Errorf("the set should have %s", tt.key.Inspect())
+		}
+	}
+
+	for _, missing := range []object.Object{
+		place("home", 2, 1),
+		route(place("work", 3, 4.5), place("home", 1, 2)),
+	} {
+		if _, ok := hash.Get(missing.(object.Hashable)); ok {
+			t.Errorf("%s shouldn't be found", missing.Inspect())
+		}
+	}
+}
+
+func TestFloatKeys(t *testing.T) {
+	nan := &object.Float{Value: math.NaN()}
+
+	if nan.HashKey() != (&object.Float{Value: -math.NaN()}).HashKey() || !nan.SameKey(&object.Float{Value: math.NaN()}) {
+		t.Errorf("every nan should be the same key")
+	}
+
+	zero, negativeZero := &object.Float{Value: 0}, &object.Float{Value: math.Copysign(0, -1)}
+
+	if zero.HashKey() != negativeZero.HashKey() || !zero.SameKey(negativeZero) {
+		t.Errorf("0.0 and -0.0 should be the same key")
+	}
+
+	// 2^53 + 1 isn't a float, the nearest one is 2^53, which mustn't be taken for it
+	big := &object.Integer{Value: 1<<53 + 1}
+	if big.SameKey(&object.Float{Value: float64(big.Value)}) {
+		t.Errorf("%d shouldn't be the same key as the float nearest to it", big.Value)
+	}
+
+	huge := &object.Float{Value: math.MaxInt64}
+	if huge.SameKey(&object.Integer{Value: math.MaxInt64}) {
+		t.Errorf("2^63 shouldn't be the same key as the largest integer")
+	}
+}
+
+func TestTypeDefEquality(t *testing.T) {
+	x, y := &object.String{Value: "x"}, &object.String{Value: "y"}
+
+	point := typeDef("Point", x, &object.Array{Elements: []object.Object{&object.Integer{Value: 1}}}, y, &object.Integer{Value: 2})
+	same := typeDef("Point", y, &object.Float{Value: 2}, x, &object.Array{Elements: []object.Object{&object.Float{Value: 1}}})
+
+	if !object.Equal(point, same) {
+		t.Errorf("%s should equal %s", point.Inspect(), same.Inspect())
+	}
+
+	if object.Identical(point, same) {
+		t.Errorf("equal typedefs that are different objects shouldn't be identical")
+	}
+
+	for _, other := range []object.Object{
+		typeDef("Vector", x, point.Attributes.Pairs()[0].Value, y, &object.Integer{Value: 2}),
+		typeDef("Point", x, &object.Array{}, y, &object.Integer{Value: 2}),
+		&object.TypeDef{Name: "Point"},
+		point.Attributes,
+	} {
+		if object.Equal(point, other) {
+			t.Errorf("%s shouldn't equal %s", point.Inspect(), other.Inspect())
+		}
+	}
+
+	if !object.Equal(&object.TypeDef{Name: "Empty"}, typeDef("Empty")) {
+		t.Errorf("typedefs without attributes should be equal whether or not they have a hash for them")
+	}
+}
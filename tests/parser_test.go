@@ -469,6 +469,57 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestPipeParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a | f", "(a|f)"},
+		{"a | f | g(2)", "((a|f)|g(2))"},
+		{"a + b | f", "((a+b)|f)"},
+		{"a | f == b", "((a|f)==b)"},
+		{"a | f | g < b | h", "(((a|f)|g)<(b|h))"},
+		{"x in a | f", "(xin(a|f))"},
+		{"a | f == b && c | g", "(((a|f)==b)&&(c|g))"},
+		{"a | m.f(1)", "(a|(m.f)(1))"},
+		{"[1, 2] | fn(x) { x }", "([1, 2]|fn(x) x)"},
+	}
+
+	for _, tt := range tests {
+		l := Lexer.New(strings.NewReader(tt.input), "Test")
+		p := Parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestInParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a in s", "(ains)"},
+		{"a + 1 in s", "((a+1)ins)"},
+		{"a in s == true", "((ains)==true)"},
+		{"!(a in s)", "(!(ains)("},
+	}
+
+	for _, tt := range tests {
+		l := Lexer.New(strings.NewReader(tt.input), "Test")
+		p := Parser.New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, actual)
+		}
+	}
+}
+
 func testLiteralExpression(
 	t *testing.T,
 	exp Ast.Expression,
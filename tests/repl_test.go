@@ -0,0 +1,67 @@
+package Tests
+
+import (
+	"bytes"
+	"github/FabioVV/comp_lang/repl"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "lib.momo")
+	if err := os.WriteFile(script, []byte("var double = fn(x) { x * 2 };"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"var add = fn(a, b) {",
+		"  return a + b;",
+		"};",
+		"add(1,",
+		"  2)",
+		":type add(1, 2)",
+		":load " + script,
+		"double(21)",
+		":globals",
+		":disasm 1 + 2",
+		":ast -x",
+		"/* a comment",
+		"that goes on */ 7",
+		":nope",
+		":reset",
+		":globals",
+		"double(1)",
+		":quit",
+		"100",
+	}, "\n")
+
+	var out bytes.Buffer
+	repl.Start(strings.NewReader(input), &out)
+
+	tests := []struct {
+		expected string
+		present  bool
+	}{
+		{repl.CONTINUEPROMPT, true},
+		{"3\n", true},
+		{"INTEGER\n", true},
+		{"loaded " + script, true},
+		{"42\n", true},
+		{"add = closure", true},
+		{"double = closure", true},
+		{"0006 OpAdd\n0007 OpPop\n", true},
+		{"PrefixExpression\n    Operator: \"-\"\n    Right: Identifier\n      Value: \"x\"\n", true},
+		{"7\n", true},
+		{"unknown command :nope", true},
+		{"compilation failed", true},
+		{"100", false},
+	}
+
+	for _, tt := range tests {
+		if strings.Contains(out.String(), tt.expected) != tt.present {
+			t.Errorf("expected %q present=%t in REPL output, got:\n%s", tt.expected, tt.present, out.String())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package Tests
+
+import (
+	"errors"
+	"github/FabioVV/comp_lang/tester"
+	"github/FabioVV/comp_lang/vm"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTesterRunFile(t *testing.T) {
+	input := `
+	var counter = 0;
+
+	fn test_pass() {
+		counter = counter + 1;
+		assert_eq(1 + 1, 2);
+	}
+
+	fn test_fail() {
+		assert_eq([1, 2], [1, 3]);
+	}
+
+	fn test_error() {
+		assert_error(fn() { 1 + "a" });
+	}
+
+	fn helper() {
+		assert(false);
+	}
+	`
+
+	path := filepath.Join(t.TempDir(), "sample_test.momo")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := tester.RunFile(path)
+	if err != nil {
+		t.Fatalf("RunFile failed: %s", err)
+	}
+
+	expected := map[string]bool{"test_pass": true, "test_fail": false, "test_error": true}
+
+	if len(results) != len(expected) {
+		t.Fatalf("wrong number of results. want=%d, got=%d", len(expected), len(results))
+	}
+
+	for _, r := range results {
+		if r.Passed() != expected[r.Name] {
+			t.Errorf("%s: passed=%t, want %t (%v)", r.Name, r.Passed(), expected[r.Name], r.Err)
+		}
+	}
+
+	var assertion *vm.AssertionError
+	if !errors.As(results[1].Err, &assertion) {
+		t.Fatalf("test_fail should fail with an *vm.AssertionError, got %v", results[1].Err)
+	}
+
+	if assertion.Expected != "[1, 3]" || assertion.Actual != "[1, 2]" || assertion.Pos.Line != 10 {
+		t.Errorf("wrong assertion error: %+v", assertion)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	got := tester.Diff("a\nb\nc", "a\nc\nd")
+	want := "  a\n- b\n  c\n+ d\n"
+
+	if got != want {
+		t.Errorf("wrong diff. want=%q, got=%q", want, got)
+	}
+}
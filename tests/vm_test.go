@@ -0,0 +1,783 @@
+package Tests
+
+import (
+	"bytes"
+	"errors"
+	code "github/FabioVV/comp_lang/code"
+	"github/FabioVV/comp_lang/compiler"
+	Lexer "github/FabioVV/comp_lang/lexer"
+	object "github/FabioVV/comp_lang/object"
+	Parser "github/FabioVV/comp_lang/parser"
+	"github/FabioVV/comp_lang/vm"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func compileInput(t *testing.T, input string) *compiler.Bytecode {
+	l := Lexer.New(strings.NewReader(input), "Test")
+	p := Parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err.Inspect())
+	}
+
+	return comp.Bytecode()
+}
+
+// Runs input and returns what it evaluated to. The formatter tests use it to check formatting keeps a program's meaning
+func vmRun(t *testing.T, input string) string {
+	machine := vm.NewVM(compileInput(t, input))
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return machine.LastPoppedStackElement().Inspect()
+}
+
+func TestTracer(t *testing.T) {
+	input := `
+	var double = fn(a) { a * 2 };
+	var other = fn(a) { a + 1 };
+	other(double(5))
+	`
+
+	var out bytes.Buffer
+
+	machine := vm.NewVM(compileInput(t, input))
+	machine.SetTracer(vm.NewTracer(&out, "double"))
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 traced instructions, got=%d\n%s", len(lines), out.String())
+	}
+
+	expected := []string{"OpGetLocal 0", "OpConstant", "OpMul", "OpReturnValue"}
+
+	for i, line := range lines {
+		if !strings.Contains(line, "double") {
+			t.Errorf("line %d is not inside 'double': %q", i, line)
+		}
+
+		if !strings.Contains(line, expected[i]) {
+			t.Errorf("line %d expected to contain %q, got=%q", i, expected[i], line)
+		}
+	}
+
+	if !strings.HasSuffix(lines[2], "5, 2]") {
+		t.Errorf("stack view wrong before OpMul, got=%q", lines[2])
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	input := `
+	var fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+	fib(10)
+	`
+
+	machine := vm.NewVM(compileInput(t, input))
+	profiler := vm.NewProfiler(1)
+	machine.SetProfiler(profiler)
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var report bytes.Buffer
+	if err := profiler.WriteReport(&report); err != nil {
+		t.Fatalf("writing report failed: %s", err)
+	}
+
+	// fib(10) makes 177 calls in total
+	for _, want := range []string{"OpCall", "OpReturnValue", "fib", "177"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report does not mention %q\n%s", want, report.String())
+		}
+	}
+
+	var folded bytes.Buffer
+	if err := profiler.WriteCollapsed(&folded); err != nil {
+		t.Fatalf("writing collapsed stacks failed: %s", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(folded.String()), "\n") {
+		if !strings.HasPrefix(line, "<main>") {
+			t.Errorf("stack does not start at <main>: %q", line)
+		}
+	}
+
+	if !strings.Contains(folded.String(), "<main>;fib;fib;fib ") {
+		t.Errorf("expected nested fib stacks, got=\n%s", folded.String())
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	input := `var pick = fn(n) {
+	if (n > 2) {
+		return "big";
+	}
+	"small"
+};
+pick(1)
+`
+
+	bytecode := compileInput(t, input)
+
+	machine := vm.NewVM(bytecode)
+	coverage := vm.NewCoverage(bytecode)
+	machine.SetCoverage(coverage)
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var lcov bytes.Buffer
+	if err := coverage.WriteLCOV(&lcov); err != nil {
+		t.Fatalf("writing lcov failed: %s", err)
+	}
+
+	expected := []string{"DA:1,1", "DA:2,1", "DA:3,0", "DA:5,1", "DA:7,1", "LF:5", "LH:4", "end_of_record"}
+
+	for _, want := range expected {
+		if !strings.Contains(lcov.String(), want+"\n") {
+			t.Errorf("lcov output is missing %q\n%s", want, lcov.String())
+		}
+	}
+}
+
+// Lines of a file pulled in with #load are reported under that file, not under the one doing the #load
+func TestCoverageOfLoadedFile(t *testing.T) {
+	dir := t.TempDir()
+
+	helper := `var half = fn(n) {
+	if (n > 10) {
+		return n / 2;
+	}
+	n
+};
+`
+	if err := os.WriteFile(dir+"/helper.momo", []byte(helper), 0644); err != nil {
+		t.Fatalf("writing helper.momo failed: %s", err)
+	}
+
+	main := dir + "/main.momo"
+	input := `#load "helper.momo";
+half(4)
+`
+
+	l := Lexer.New(strings.NewReader(input), main)
+	p := Parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err.Inspect())
+	}
+
+	bytecode := comp.Bytecode()
+
+	machine := vm.NewVM(bytecode)
+	coverage := vm.NewCoverage(bytecode)
+	machine.SetCoverage(coverage)
+
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var lcov bytes.Buffer
+	if err := coverage.WriteLCOV(&lcov); err != nil {
+		t.Fatalf("writing lcov failed: %s", err)
+	}
+
+	records := map[string]string{}
+	for _, record := range strings.Split(lcov.String(), "end_of_record\n") {
+		if name, rest, ok := strings.Cut(strings.TrimPrefix(record, "TN:\n"), "\n"); ok {
+			records[strings.TrimPrefix(name, "SF:")] = rest
+		}
+	}
+
+	expected := map[string][]string{
+		main:                 {"DA:1,1", "DA:2,1", "LF:2", "LH:2"},
+		dir + "/helper.momo": {"DA:1,1", "DA:2,1", "DA:3,0", "DA:5,1", "LF:4", "LH:3"},
+	}
+
+	for file, lines := range expected {
+		record, ok := records[file]
+		if !ok {
+			t.Errorf("lcov output has no record for %s\n%s", file, lcov.String())
+			continue
+		}
+
+		for _, want := range lines {
+			if !strings.Contains(record, want+"\n") {
+				t.Errorf("record for %s is missing %q\n%s", file, want, record)
+			}
+		}
+	}
+}
+
+// fn name(...) { ... } compiles to the same bytecode as var name = fn(...) { ... }
+func TestFunctionStatements(t *testing.T) {
+	statement := compileInput(t, "fn add(a, b) { a + b }\nadd(1, 2)")
+	variable := compileInput(t, "var add = fn(a, b) { a + b }; add(1, 2)")
+
+	if statement.Instructions.MiniDisassembler() != variable.Instructions.MiniDisassembler() {
+		t.Errorf("a function statement compiled differently from a var.\nstatement:\n%s\nvar:\n%s",
+			statement.Instructions.MiniDisassembler(), variable.Instructions.MiniDisassembler())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { a + b }\nadd(1, 2)", "3"},
+		{"fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) }\nfact(5)", "120"},
+		{"fn outer(x) { fn inner(y) { x + y }\ninner(2) }\nouter(1)", "3"},
+		{"fn adder(x) { fn(y) { x + y } }\nadder(10)(5)", "15"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestBytecodeEncoding(t *testing.T) {
+	input := `
+	var add = fn(a, b) { a + b };
+	var greet = fn(name) { "hi " + name };
+	[add(1, 2), add(1.5, 1.0), greet("momo")]
+	`
+
+	var buf bytes.Buffer
+
+	if err := compileInput(t, input).Encode(&buf); err != nil {
+		t.Fatalf("encoding failed: %s", err)
+	}
+
+	code, err := compiler.DecodeBytecode(&buf)
+	if err != nil {
+		t.Fatalf("decoding failed: %s", err)
+	}
+
+	machine := vm.NewVM(code)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	expected := "[3, 2.5, hi momo]"
+	if got := machine.LastPoppedStackElement().Inspect(); got != expected {
+		t.Errorf("wrong result from decoded bytecode. want=%q, got=%q", expected, got)
+	}
+
+	if _, err := compiler.DecodeBytecode(strings.NewReader("var a = 1;")); err == nil {
+		t.Errorf("expected source code to be rejected as bytecode")
+	}
+}
+
+// What compiled files of each version index into, a change to either table needs a new version here
+var bytecodeLayouts = map[int]struct {
+	opcodes  []string
+	builtins []string
+}{
+	2: {
+		opcodes: []string{
+			"OpConstant", "OpAdd", "OpPop", "OpSub", "OpMul", "OpDiv", "OpTrue", "OpFalse",
+			"OpEqual", "OpNotEqual", "OpGreaterThan", "OpMinus", "OpBang", "OpJumpNotTruthy", "OpJump", "OpNull",
+			"OpGetGlobal", "OpSetGlobal", "OpGetLocal", "OpSetLocal", "OpGetFree", "OpArray", "OpHash", "OpIndex",
+			"OpCall", "OpReturnValue", "OpReturn", "OpGetBuiltin", "OpClosure", "OpCurrentClosure", "OpLoadModule", "OpIn",
+		},
+		builtins: []string{
+			"len", "assert", "assert_eq", "assert_error", "puts", "print", "args", "env",
+			"set_env", "exit", "set", "keys", "values", "tuple", "identical",
+		},
+	},
+}
+
+func TestBytecodeLayout(t *testing.T) {
+	layout, ok := bytecodeLayouts[compiler.BYTECODEVERSION]
+	if !ok {
+		t.Fatalf("no layout recorded for bytecode version %d, add the current opcodes and builtins", compiler.BYTECODEVERSION)
+	}
+
+	opcodes := []string{}
+	for op := 0; op < 256; op++ {
+		def, err := code.LookupOp(byte(op))
+		if err != nil {
+			break
+		}
+		opcodes = append(opcodes, def.Name)
+	}
+
+	builtins := []string{}
+	for _, b := range object.Builtins {
+		builtins = append(builtins, b.Name)
+	}
+
+	if strings.Join(opcodes, " ") != strings.Join(layout.opcodes, " ") {
+		t.Errorf("opcodes changed under bytecode version %d, bump compiler.BYTECODEVERSION.\nwant=%v\ngot=%v", compiler.BYTECODEVERSION, layout.opcodes, opcodes)
+	}
+
+	if strings.Join(builtins, " ") != strings.Join(layout.builtins, " ") {
+		t.Errorf("builtins changed under bytecode version %d, bump compiler.BYTECODEVERSION.\nwant=%v\ngot=%v", compiler.BYTECODEVERSION, layout.builtins, builtins)
+	}
+}
+
+func TestOutputBuiltins(t *testing.T) {
+	var out bytes.Buffer
+
+	object.Stdout = &out
+	defer func() { object.Stdout = os.Stdout }()
+
+	vmRun(t, `puts(1, "two"); print("a", 2.5); puts(true)`)
+
+	expected := "1\ntwo\na2.5true\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input string
+		code  int
+	}{
+		{`exit()`, 0},
+		{`exit(3); 1 / 0`, 3},
+		{`var f = fn() { if (true) { exit(4) } 5 }; f() + 1`, 4},
+		// assert_error catching the failure of its callback must not swallow the exit
+		{`assert_error(fn() { exit(5) }); 1`, 5},
+	}
+
+	for _, tt := range tests {
+		machine := vm.NewVM(compileInput(t, tt.input))
+		err := machine.Run()
+
+		var exit *vm.ExitError
+		if !errors.As(err, &exit) {
+			t.Errorf("expected %q to exit, got err=%v", tt.input, err)
+			continue
+		}
+
+		if exit.Code != tt.code {
+			t.Errorf("wrong exit code for %q. want=%d, got=%d", tt.input, tt.code, exit.Code)
+		}
+	}
+
+	if got := vmRun(t, `exit("1")`); !strings.Contains(got, "must be INTEGER") {
+		t.Errorf("expected exit to reject a string code, got %q", got)
+	}
+}
+
+// A failed assert or an exit in a function a builtin calls back into stops the program, it isn't an error value
+func TestCallbackHalts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/lines.txt", []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("writing lines.txt failed: %s", err)
+	}
+
+	callbacks := []string{
+		`assert_error(fn() { CALLBACK })`,
+		`set(1, 2).each(fn(x) { CALLBACK })`,
+		`#load "fs"; fs.each_line("DIR/lines.txt", fn(l) { CALLBACK })`,
+		`#load "re"; re.replace("a", "banana", fn(m) { CALLBACK })`,
+	}
+
+	for _, callback := range callbacks {
+		callback = strings.ReplaceAll(callback, "DIR", dir)
+
+		input := strings.ReplaceAll(callback, "CALLBACK", `assert(false, "inside")`) + "; 1"
+		err := vm.NewVM(compileInput(t, input)).Run()
+
+		var assertion *vm.AssertionError
+		if !errors.As(err, &assertion) || assertion.Message != "inside" {
+			t.Errorf("expected the assertion in %q to fail the program, got err=%v", input, err)
+		}
+
+		input = strings.ReplaceAll(callback, "CALLBACK", "exit(7)") + "; 1"
+		err = vm.NewVM(compileInput(t, input)).Run()
+
+		var exit *vm.ExitError
+		if !errors.As(err, &exit) || exit.Code != 7 {
+			t.Errorf("expected the exit in %q to end the program with 7, got err=%v", input, err)
+		}
+	}
+
+	// Runtime errors are still what assert_error looks for
+	if got := vmRun(t, `assert_error(fn() { 1 + "a" }); 1`); got != "1" {
+		t.Errorf("assert_error should pass on a runtime error, got %s", got)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	if got := vmRun(t, "args"); got != "[]" {
+		t.Errorf("args should be empty when the script got none, got %s", got)
+	}
+
+	object.SetArgs([]string{"one", "two"})
+	defer object.SetArgs([]string{})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"args", "[one, two]"},
+		{"[len(args), args[1]]", "[2, two]"},
+		{"var f = fn() { args }; f()", "[one, two]"},
+		{"identical(args, args)", "false"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEnvBuiltins(t *testing.T) {
+	t.Setenv("MOMO_TEST_ENV", "before")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`env("MOMO_TEST_ENV")`, "before"},
+		{`env("MOMO_TEST_ENV_UNSET")`, "null"},
+		{`set_env("MOMO_TEST_ENV", "after"); env("MOMO_TEST_ENV")`, "after"},
+		{`env(1)`, "ERROR: argument to 'env' must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	// Sleeps that take a day, Cancel has to wake them up and stop the VM
+	inputs := []string{
+		`#load "time"; time.sleep(time.day); 1`,
+		`#load "time"; var f = fn() { time.sleep(time.day) }; f()`,
+	}
+
+	for _, input := range inputs {
+		machine := vm.NewVM(compileInput(t, input))
+
+		done := make(chan error, 1)
+		go func() { done <- machine.Run() }()
+
+		time.Sleep(20 * time.Millisecond)
+		machine.Cancel()
+		machine.Cancel()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, vm.ErrCancelled) {
+				t.Errorf("expected ErrCancelled for %q, got=%v", input, err)
+			}
+
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Cancel didn't stop %q", input)
+		}
+	}
+
+	machine := vm.NewVM(compileInput(t, "1 + 1"))
+	machine.Cancel()
+
+	if err := machine.Run(); !errors.Is(err, vm.ErrCancelled) {
+		t.Errorf("a cancelled VM shouldn't run, got=%v", err)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var double = fn(x) { x * 2 }; 3 | double", "6"},
+		{"var double = fn(x) { x * 2 }; var add = fn(a, b) { a + b }; 3 | double | add(1)", "7"},
+		{"var sub = fn(a, b) { a - b }; 10 | sub(3)", "7"},
+		{"var double = fn(x) { x * 2 }; 1 + 2 | double", "6"},
+		{`"x" | fn(s) { s + "!" }`, "x!"},
+		{"var k = fn(a) { fn(b) { a * b } }; 4 | k(3)", "ERROR: wrong number of arguments"},
+		{`#load "strings"; " a,b " | strings.trim | strings.split(",")`, "[a, b]"},
+		{`#load "math"; [9, 4] | math.max | math.sqrt`, "3.0"},
+		{"var double = fn(x) { x * 2 }; [2 | double == 4, 2 | double > 3, 1 | double == 2 | double]", "[true, true, false]"},
+	}
+
+	for _, tt := range tests {
+		machine := vm.NewVM(compileInput(t, tt.input))
+
+		err := machine.Run()
+
+		if strings.HasPrefix(tt.expected, "ERROR: ") {
+			if err == nil || !strings.Contains(err.Error(), strings.TrimPrefix(tt.expected, "ERROR: ")) {
+				t.Errorf("expected an error containing %q for %q, got=%v", tt.expected, tt.input, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		if got := machine.LastPoppedStackElement().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// A pipe is only another way to write the call
+	piped := compileInput(t, "var f = fn(a, b) { a }; 1 | f(2)")
+	called := compileInput(t, "var f = fn(a, b) { a }; f(1, 2)")
+
+	if piped.Instructions.MiniDisassembler() != called.Instructions.MiniDisassembler() {
+		t.Errorf("pipe compiled differently from the call.\npipe:\n%s\ncall:\n%s", piped.Instructions.MiniDisassembler(), called.Instructions.MiniDisassembler())
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"set()", "set()"},
+		{"set(3, 1, 2, 1)", "set(1, 2, 3)"},
+		{`set([1, "a", true])`, "set(1, a, true)"},
+		{"set([1, 2], 3)", "ERROR: unusable as set element: ARRAY"},
+		{"[len(set(1, 2, 2)), set(1, 2).len()]", "[2, 2]"},
+		{"var s = set(1, 2); [s.has(2), s.has(5), 2 in s, 5 in s, [1] in s]", "[true, false, true, false, false]"},
+		{"var s = set(1); s.add(2, 3).remove(1); s", "set(2, 3)"},
+		{"set(1).add([1])", "ERROR: unusable as set element: ARRAY"},
+		{"set(1, 2).union(set(2, 3))", "set(1, 2, 3)"},
+		{"set(1, 2).intersection(set(2, 3))", "set(2)"},
+		{"set(1, 2).difference(set(2, 3))", "set(1)"},
+		{"set(1).union([1])", "ERROR: argument to 'union' must be a SET, got ARRAY"},
+		{"[set(1, 2) == set(2, 1), set(1) == set(1, 2), set(1) != set(2), set() == set()]", "[true, false, true, true]"},
+		{`set("b", "a").values()`, "[a, b]"},
+		{`#load "fs"; set(1, 2, 3).each(fn(x) { fs.append_file("DIR/each.txt", "x") }); fs.read_file("DIR/each.txt")`, "xxx"},
+	}
+
+	dir := t.TempDir()
+
+	for _, tt := range tests {
+		if got := vmRun(t, strings.ReplaceAll(tt.input, "DIR", dir)); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	machine := vm.NewVM(compileInput(t, "set(1).push(2)"))
+
+	if err := machine.Run(); err == nil || err.Error() != "sets have no method 'push'" {
+		t.Errorf("expected an error for an unknown set method, got=%v", err)
+	}
+}
+
+func TestIn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`["a" in {"a": 1}, "b" in {"a": 1}, [1] in {"a": 1}]`, "[true, false, false]"},
+		{`[2 in [1, 2], 3 in [1, 2], "x" in ["x"]]`, "[true, false, true]"},
+		{`["ell" in "hello", "z" in "hello"]`, "[true, false]"},
+		{"var x = [1]; [x in [x], [1] in [[1]], [2] in [[1]]]", "[true, true, false]"},
+		{"if (2 in set(1, 2)) { 10 } else { 20 }", "10"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"1 in 2", "1 in \"a\""} {
+		machine := vm.NewVM(compileInput(t, input))
+
+		if err := machine.Run(); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestLen(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`len("")`, "0"},
+		{`len("héllo")`, "5"},
+		{"len([1, 2, 3])", "3"},
+		{`len({"a": 1, "b": 2})`, "2"},
+		{"len(set(1, 1, 2))", "2"},
+		{"len(1)", "ERROR: argument to 'len' not supported, got INTEGER"},
+		{"len([], [])", "ERROR: wrong number of arguments for 'len'. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"ab" + "c" == "a" + "bc"`, "true"},
+		{`"ab" == "ba"`, "false"},
+		{"[1, 2] == [1, 2]", "true"},
+		{"[1, 2] != [1, 2]", "false"},
+		{"[1, 2] == [2, 1]", "false"},
+		{"[1, [2, [3]]] == [1, [2, [3]]]", "true"},
+		{"[1] == [1, 1]", "false"},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, "true"},
+		{`{"a": 1} == {"a": 2}`, "false"},
+		{`{"a": 1} == {"b": 1}`, "false"},
+		{"1 == 1.0", "true"},
+		{"[1, 2.0] == [1.0, 2]", "true"},
+		{"1 == 1.5", "false"},
+		{"9007199254740993 == 9007199254740992.0", "false"},
+		{`#load "math"; math.nan == math.nan`, "false"},
+		{`#load "math"; math.nan != math.nan`, "true"},
+		{"0.0 == -0.0", "true"},
+		{"tuple(1, 2) == tuple(1, 2)", "true"},
+		{"tuple(1, 2) == [1, 2]", "false"},
+		{"set(1, 2) == set(2, 1)", "true"},
+		{`1 == "1"`, "false"},
+		{"[] == {}", "false"},
+		{"var f = fn() { 1 }; [f == f, f == fn() { 1 }]", "[true, false]"},
+		{`identical("a" + "b", "a" + "b")`, "false"},
+		{`var s = "ab"; identical(s, s)`, "true"},
+		{"var a = [1]; [identical(a, a), identical(a, [1])]", "[true, false]"},
+		{"[identical(1, 1), identical(1, 1.0), identical(true, 1 == 1)]", "[true, false, true]"},
+		{"[identical(0.5, 0.5), identical(0.0, -0.0), identical(0.5, 1.5)]", "[true, true, false]"},
+		// nan isn't equal to itself, but it is identical to itself, so in finds it like a set does
+		{`#load "math"; var n = math.nan; [n == n, identical(n, n), identical(n, math.nan), identical(n, 1.0)]`, "[false, true, true, false]"},
+		{`#load "math"; var n = math.nan; var a = [n]; [a[0] in a, n in [1, n], n in [1.0], n in set(n), set(n).has(n)]`, "[true, true, false, true, true]"},
+		{"identical(1)", "ERROR: wrong number of arguments for 'identical'. got=1, want=2"},
+		// Booleans builtins return are their own objects, they still compare and negate by value
+		{"[set(1).has(1) == true, set(1).has(2) == false, set(1).has(1) != true]", "[true, true, false]"},
+		{"[!set(1).has(1), !set(1).has(2), !!set(1).has(1)]", "[false, true, true]"},
+		{"[!0, !\"\", !fn() { 1 }]", "[false, false, false]"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.5", "2.5"},
+		{"1.0", "1.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1e21", "1e+21"},
+		{`#load "math"; [math.nan, math.inf, -math.inf]`, "[nan, inf, -inf]"},
+		{"-1.5", "-1.5"},
+		{"-(2.0 * 3.0)", "-6.0"},
+		{"var x = 0.5; -x", "-0.5"},
+		{"[1 < 1.5, 2.0 > 1, 1.5 < 1, 2 > 2.0]", "[true, true, false, false]"},
+		{"[1 == 1.0, 1 != 1.0, 2 == 2.5]", "[true, false, false]"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	machine := vm.NewVM(compileInput(t, `-"a"`))
+	if err := machine.Run(); err == nil || err.Error() != "unsupported type for negation: STRING" {
+		t.Errorf("expected negating a string to fail, got %v", err)
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{1: "a"}[1.0]`, "a"},
+		{`{1.0: "a"}[1]`, "a"},
+		{`{1: "a", 1.0: "b"}`, "{1: b}"},
+		{`{1.5: "a"}[1.5]`, "a"},
+		{`{1.5: "a"}[1]`, "null"},
+		{`{0.0: "a"}[-0.0]`, "a"},
+		{`#load "math"; {math.nan: "a"}[math.nan]`, "a"},
+		{`#load "math"; {math.nan: "a", math.nan: "b"}`, "{nan: b}"},
+		{`#load "math"; len(set(math.nan, math.nan, 1, 1.0))`, "2"},
+		{`{tuple(1, 2): "a"}[tuple(1, 2)]`, "a"},
+		{`{tuple(1, 2): "a"}[tuple(2, 1)]`, "null"},
+		{`{tuple(1, tuple("x", true)): "a"}[tuple(1.0, tuple("x", true))]`, "a"},
+		{`{tuple([1, 2]): "a"}[tuple(1, 2)]`, "a"},
+		{`len(set(tuple(1, 2), tuple(1, 2), tuple(2)))`, "2"},
+		{`tuple(1, 2) in set(tuple(1, 2))`, "true"},
+		{`tuple(1, 2) in [tuple(1, 2)]`, "true"},
+		{`2 in tuple(1, 2)`, "true"},
+		{`tuple(1, 2)[1]`, "2"},
+		{`tuple(1, 2)[2]`, "null"},
+		{`len(tuple(1, 2, 3))`, "3"},
+		{`tuple()`, "tuple()"},
+		{`set(tuple({}))`, "ERROR: unusable as set element: TUPLE"},
+	}
+
+	for _, tt := range tests {
+		if got := vmRun(t, tt.input); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// A tuple is only a key when everything in it is
+	for _, input := range []string{`{tuple(1, [2]): "a"}`, `{[1]: "a"}`, `{"a": 1}[tuple({})]`} {
+		machine := vm.NewVM(compileInput(t, input))
+
+		if err := machine.Run(); err == nil || !strings.HasPrefix(err.Error(), "unusable as hash key") {
+			t.Errorf("expected an unusable key error for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, "c": 3}`, "{b: 1, a: 2, c: 3}"},
+		{`{3: "x", 1: "y", true: "z"}`, "{3: x, 1: y, true: z}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`keys({"z": 1, "y": 2, "x": 3})`, "[z, y, x]"},
+		{`values({"z": 1, "y": 2, "x": 3})`, "[1, 2, 3]"},
+		{`keys({})`, "[]"},
+		{`keys([1])`, "ERROR: argument to 'keys' must be a HASH, got ARRAY"},
+		{`#load "time"; keys(time.fields(time.now()))`, "[year, month, day, hour, minute, second, nanosecond, weekday]"},
+	}
+
+	for _, tt := range tests {
+		// Printing the same hash many times must always give the same text
+		for i := 0; i < 20; i++ {
+			if got := vmRun(t, tt.input); got != tt.expected {
+				t.Fatalf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+			}
+		}
+	}
+}
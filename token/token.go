@@ -1,5 +1,7 @@
 package Token
 
+import "sort"
+
 /*
 We defined the TokenType type to be a string. That allows us to use many different values
 as TokenTypes, which in turn allows us to distinguish between different types of tokens. Using
@@ -18,6 +20,7 @@ type Token struct {
 	Pos      Position
 	Filename string
 	Literal  string
+	Newlines int // How many line breaks there were between the end of the previous token and this one
 }
 
 // Token's list
@@ -104,6 +107,7 @@ const (
 	BREAK              = "BREAK"
 	CONTINUE           = "CONTINUE"
 	LOAD               = "LOAD"
+	IN                 = "IN"
 )
 
 var keywords = map[string]TokenType{
@@ -120,6 +124,19 @@ var keywords = map[string]TokenType{
 	"break":    BREAK,
 	"continue": CONTINUE,
 	"load":     LOAD,
+	"in":       IN,
+}
+
+// Keywords returns every keyword of the language, sorted
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+
+	for word := range keywords {
+		words = append(words, word)
+	}
+
+	sort.Strings(words)
+	return words
 }
 
 func LookupIdentifier(ident string) TokenType {
@@ -0,0 +1,161 @@
+package vm
+
+import (
+	"fmt"
+	code "github/FabioVV/comp_lang/code"
+	"github/FabioVV/comp_lang/compiler"
+	object "github/FabioVV/comp_lang/object"
+	"io"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+/*
+Coverage counts how many times every source line ran. The lines that can run at all are the ones
+the compiler left in a source map, either the main program's or the one of a compiled function in
+the constant pool, so files pulled in by #load are covered too.
+A line counts as executed when the VM reaches the first instruction the compiler emitted for it,
+executing the rest of the instructions of that line doesn't count it again.
+*/
+type Coverage struct {
+	files map[string]map[int]int64 // filename -> line -> times executed
+}
+
+func NewCoverage(bytecode *compiler.Bytecode) *Coverage {
+	c := &Coverage{files: make(map[string]map[int]int64)}
+
+	c.addSourceMap(bytecode.SourceMap)
+
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			c.addSourceMap(fn.SourceMap)
+		}
+	}
+
+	return c
+}
+
+// Turns coverage on for this VM. Passing nil turns it off again
+func (vm *VM) SetCoverage(c *Coverage) {
+	vm.coverage = c
+}
+
+func (c *Coverage) addSourceMap(sm code.SourceMap) {
+	for _, pos := range sm {
+		lines, ok := c.files[pos.Filename]
+
+		if !ok {
+			lines = make(map[int]int64)
+			c.files[pos.Filename] = lines
+		}
+
+		if _, ok := lines[pos.Line]; !ok {
+			lines[pos.Line] = 0
+		}
+	}
+}
+
+func (c *Coverage) hit(fn *object.CompiledFunction, ip int) {
+	i := fn.SourceMap.Index(ip)
+
+	if i < 0 || fn.SourceMap[i].Offset != ip {
+		return
+	}
+
+	pos := fn.SourceMap[i]
+	c.files[pos.Filename][pos.Line]++
+}
+
+func (c *Coverage) sortedFiles() []string {
+	names := make([]string, 0, len(c.files))
+
+	for name := range c.files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func sortedLines(lines map[int]int64) []int {
+	numbers := make([]int, 0, len(lines))
+
+	for line := range lines {
+		numbers = append(numbers, line)
+	}
+
+	sort.Ints(numbers)
+	return numbers
+}
+
+func linesHit(lines map[int]int64) int {
+	hit := 0
+
+	for _, count := range lines {
+		if count > 0 {
+			hit++
+		}
+	}
+
+	return hit
+}
+
+// Writes the coverage as an LCOV tracefile (the format genhtml and most CI coverage tools read)
+func (c *Coverage) WriteLCOV(out io.Writer) error {
+	for _, name := range c.sortedFiles() {
+		lines := c.files[name]
+
+		path, err := filepath.Abs(name)
+		if err != nil {
+			path = name
+		}
+
+		fmt.Fprintf(out, "TN:\n")
+		fmt.Fprintf(out, "SF:%s\n", path)
+
+		for _, line := range sortedLines(lines) {
+			fmt.Fprintf(out, "DA:%d,%d\n", line, lines[line])
+		}
+
+		fmt.Fprintf(out, "LF:%d\n", len(lines))
+		fmt.Fprintf(out, "LH:%d\n", linesHit(lines))
+
+		if _, err := fmt.Fprintf(out, "end_of_record\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes a per file table with how many of the lines that could run actually ran
+func (c *Coverage) WriteSummary(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "FILE\tLINES\tHIT\tCOVERAGE\n")
+
+	total, totalHit := 0, 0
+
+	for _, name := range c.sortedFiles() {
+		lines := c.files[name]
+		hit := linesHit(lines)
+
+		total += len(lines)
+		totalHit += hit
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", name, len(lines), hit, coveragePercent(hit, len(lines)))
+	}
+
+	fmt.Fprintf(tw, "total\t%d\t%d\t%s\n", total, totalHit, coveragePercent(totalHit, total))
+
+	return tw.Flush()
+}
+
+func coveragePercent(hit int, total int) string {
+	if total == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(hit)/float64(total)*100)
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	code "github/FabioVV/comp_lang/code"
+	object "github/FabioVV/comp_lang/object"
+)
+
+// Returned by Run when one of the assert builtins fails. Pos is where the assert was called
+type AssertionError struct {
+	Message  string
+	Expected string
+	Actual   string
+	Pos      code.SourcePos
+}
+
+func (e *AssertionError) Error() string {
+	if e.Pos.Line == 0 {
+		return e.Message
+	}
+
+	return fmt.Sprintf("%s:%d: %s", e.Pos.Filename, e.Pos.Line, e.Message)
+}
+
+// A failed assertion stops the program even when it happens in a function a builtin called back into
+func (e *AssertionError) Halts() {}
+
+// Position tells builtins where they were called from
+func (vm *VM) Position() code.SourcePos {
+	return vm.currentPosition()
+}
+
+// The source position of the instruction the current frame is executing, if the compiler recorded one
+func (vm *VM) currentPosition() code.SourcePos {
+	frame := vm.currentFrame()
+
+	pos, ok := frame.cl.Fn.SourceMap.Lookup(frame.ip)
+	if !ok {
+		return code.SourcePos{}
+	}
+
+	return pos
+}
+
+func (vm *VM) newAssertionError(failure *object.AssertionFailure) *AssertionError {
+	return &AssertionError{
+		Message:  failure.Message,
+		Expected: failure.Expected,
+		Actual:   failure.Actual,
+		Pos:      vm.currentPosition(),
+	}
+}
+
+// Returned by Run when the VM was cancelled while it was running
+var ErrCancelled = errors.New("execution cancelled")
+
+// Returned by Run when the program called exit. It isn't a failure, Code is what the process should exit with
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) Halts() {}
+
+// ExitCode lets builtins that get the error back from a spawned host tell an exit from a failure
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
@@ -0,0 +1,272 @@
+package vm
+
+import (
+	"fmt"
+	code "github/FabioVV/comp_lang/code"
+	object "github/FabioVV/comp_lang/object"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// By default a call-stack sample is taken every this many executed instructions
+const PROFILESAMPLEEVERY int = 64
+
+type opcodeStats struct {
+	count int64
+	total time.Duration
+}
+
+type functionStats struct {
+	fn        *object.CompiledFunction
+	calls     int64
+	inclusive time.Duration
+	exclusive time.Duration
+	active    int // How many frames of this function are on the frame stack right now (recursion)
+}
+
+// A function call the profiler saw being pushed on the frame stack
+type activation struct {
+	stats *functionStats
+	start time.Time
+}
+
+/*
+Profiler records where a program spends its time. Instead of timing every instruction from start to end
+(the dispatch loop has way too many exit points for that) the elapsed time is charged to the previous
+instruction every time a new one is about to run. Frame pushes and pops are noticed the same way, by
+comparing the VM frame stack with the calls the profiler already knows about.
+*/
+type Profiler struct {
+	sampleEvery int64
+
+	opcodes   map[code.Opcode]*opcodeStats
+	functions map[*object.CompiledFunction]*functionStats
+	calls     []activation
+	samples   map[string]int64 // collapsed call stack (main;fn;fn) -> number of samples
+
+	running   bool
+	lastOp    code.Opcode
+	lastStart time.Time
+	lastFn    *functionStats
+
+	started      time.Time
+	elapsed      time.Duration
+	instructions int64
+}
+
+func NewProfiler(sampleEvery int) *Profiler {
+	if sampleEvery <= 0 {
+		sampleEvery = PROFILESAMPLEEVERY
+	}
+
+	return &Profiler{
+		sampleEvery: int64(sampleEvery),
+		opcodes:     make(map[code.Opcode]*opcodeStats),
+		functions:   make(map[*object.CompiledFunction]*functionStats),
+		samples:     make(map[string]int64),
+	}
+}
+
+// Turns profiling on for this VM. Passing nil turns it off again
+func (vm *VM) SetProfiler(p *Profiler) {
+	vm.profiler = p
+}
+
+func (p *Profiler) function(fn *object.CompiledFunction) *functionStats {
+	stats, ok := p.functions[fn]
+
+	if !ok {
+		stats = &functionStats{fn: fn}
+		p.functions[fn] = stats
+	}
+
+	return stats
+}
+
+// Charges the time since the last instruction started to that instruction and the function running it
+func (p *Profiler) charge(now time.Time) {
+	if !p.running {
+		return
+	}
+
+	elapsed := now.Sub(p.lastStart)
+
+	p.opcodes[p.lastOp].total += elapsed
+	p.lastFn.exclusive += elapsed
+}
+
+// Brings p.calls in line with the frames the VM has right now
+func (p *Profiler) syncCalls(vm *VM, now time.Time) {
+	for len(p.calls) > vm.framesIndex {
+		p.popCall(now)
+	}
+
+	for i := len(p.calls); i < vm.framesIndex; i++ {
+		stats := p.function(vm.frames[i].cl.Fn)
+		stats.calls++
+		stats.active++
+
+		p.calls = append(p.calls, activation{stats: stats, start: now})
+	}
+}
+
+func (p *Profiler) popCall(now time.Time) {
+	last := p.calls[len(p.calls)-1]
+	p.calls = p.calls[:len(p.calls)-1]
+
+	// Only the outermost frame of a recursive function counts, otherwise the time is counted twice
+	if last.stats.active == 1 {
+		last.stats.inclusive += now.Sub(last.start)
+	}
+
+	last.stats.active--
+}
+
+// Called by the dispatch loop right before op is executed
+func (p *Profiler) step(vm *VM, op code.Opcode) {
+	now := time.Now()
+
+	if !p.running && len(p.calls) == 0 {
+		p.started = now
+	}
+
+	p.charge(now)
+	p.syncCalls(vm, now)
+
+	stats, ok := p.opcodes[op]
+	if !ok {
+		stats = &opcodeStats{}
+		p.opcodes[op] = stats
+	}
+	stats.count++
+
+	p.running = true
+	p.lastOp = op
+	p.lastStart = now
+	p.lastFn = p.calls[len(p.calls)-1].stats
+
+	p.instructions++
+
+	if p.instructions%p.sampleEvery == 0 {
+		p.sample()
+	}
+}
+
+func (p *Profiler) sample() {
+	names := make([]string, len(p.calls))
+
+	for i, call := range p.calls {
+		names[i] = strings.ReplaceAll(functionName(call.stats.fn), ";", "_")
+	}
+
+	p.samples[strings.Join(names, ";")]++
+}
+
+// Called when the dispatch loop stops, for whatever reason
+func (p *Profiler) stop() {
+	now := time.Now()
+
+	p.charge(now)
+
+	for len(p.calls) > 0 {
+		p.popCall(now)
+	}
+
+	if p.running {
+		p.elapsed += now.Sub(p.started)
+	}
+
+	p.running = false
+}
+
+func percent(part time.Duration, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(part) / float64(total) * 100
+}
+
+// Writes a human readable report: per opcode counts and time, then per function calls and time
+func (p *Profiler) WriteReport(out io.Writer) error {
+	fmt.Fprintf(out, "momo profile\n")
+	fmt.Fprintf(out, "total time: %s   instructions: %d   samples: %d (every %d instructions)\n\n",
+		p.elapsed, p.instructions, p.instructions/p.sampleEvery, p.sampleEvery)
+
+	ops := make([]code.Opcode, 0, len(p.opcodes))
+	for op := range p.opcodes {
+		ops = append(ops, op)
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		if p.opcodes[ops[i]].total == p.opcodes[ops[j]].total {
+			return ops[i] < ops[j]
+		}
+		return p.opcodes[ops[i]].total > p.opcodes[ops[j]].total
+	})
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(tw, "OPCODE\tCOUNT\tTIME\tAVG\t%%TIME\t\n")
+	for _, op := range ops {
+		stats := p.opcodes[op]
+
+		name := fmt.Sprintf("op(%d)", op)
+		if def, err := code.LookupOp(byte(op)); err == nil {
+			name = def.Name
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%.2f\t\n", name, stats.count, stats.total,
+			stats.total/time.Duration(stats.count), percent(stats.total, p.elapsed))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fns := make([]*functionStats, 0, len(p.functions))
+	for _, stats := range p.functions {
+		fns = append(fns, stats)
+	}
+
+	sort.Slice(fns, func(i, j int) bool {
+		if fns[i].inclusive == fns[j].inclusive {
+			return functionName(fns[i].fn) < functionName(fns[j].fn)
+		}
+		return fns[i].inclusive > fns[j].inclusive
+	})
+
+	fmt.Fprintf(out, "\n")
+
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(tw, "FUNCTION\tCALLS\tINCLUSIVE\tEXCLUSIVE\t%%EXCL\t\n")
+	for _, stats := range fns {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%.2f\t\n", functionName(stats.fn), stats.calls,
+			stats.inclusive, stats.exclusive, percent(stats.exclusive, p.elapsed))
+	}
+
+	return tw.Flush()
+}
+
+// Writes the call-stack samples in the collapsed (folded) format flamegraph.pl, inferno and speedscope read:
+// one "frame;frame;frame count" line per distinct stack
+func (p *Profiler) WriteCollapsed(out io.Writer) error {
+	stacks := make([]string, 0, len(p.samples))
+	for stack := range p.samples {
+		stacks = append(stacks, stack)
+	}
+
+	sort.Strings(stacks)
+
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(out, "%s %d\n", stack, p.samples[stack]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"fmt"
+	code "github/FabioVV/comp_lang/code"
+	object "github/FabioVV/comp_lang/object"
+	"io"
+	"strings"
+)
+
+// How many of the topmost stack elements a trace line shows
+const TRACESTACKVIEW int = 4
+
+// Longest Inspect() output shown for a single stack element before it gets cut
+const TRACEVALUEWIDTH int = 24
+
+// Tracer logs every instruction the VM dispatches: frame depth, ip, the decoded opcode with its
+// operands and the top of the stack *before* the instruction runs.
+// If function is not empty only instructions executed inside a function with that name are logged.
+type Tracer struct {
+	out      io.Writer
+	function string
+}
+
+func NewTracer(out io.Writer, function string) *Tracer {
+	return &Tracer{out: out, function: function}
+}
+
+// Turns tracing on for this VM. Passing nil turns it off again
+func (vm *VM) SetTracer(t *Tracer) {
+	vm.tracer = t
+}
+
+// The name the trace uses for a compiled function, anonymous functions get a placeholder
+func functionName(fn *object.CompiledFunction) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+
+	return fn.Name
+}
+
+func (t *Tracer) trace(vm *VM, ip int, ins code.Instructions) {
+	frame := vm.currentFrame()
+	name := functionName(frame.cl.Fn)
+
+	if t.function != "" && t.function != name {
+		return
+	}
+
+	fmt.Fprintf(t.out, "[%03d] %-16s %04d %-28s | %s\n", vm.framesIndex, name, ip, fmtTracedInstruction(ins, ip), vm.stackView())
+}
+
+func fmtTracedInstruction(ins code.Instructions, ip int) string {
+	def, err := code.LookupOp(ins[ip])
+	if err != nil {
+		return err.Error()
+	}
+
+	operands, _ := code.ReadOperands(def, ins[ip+1:])
+
+	parts := []string{def.Name}
+	for _, o := range operands {
+		parts = append(parts, fmt.Sprintf("%d", o))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// A compact view of the top of the stack, the rightmost element is the top
+func (vm *VM) stackView() string {
+	start := vm.sp - TRACESTACKVIEW
+	if start < 0 {
+		start = 0
+	}
+
+	elements := []string{}
+
+	if start > 0 {
+		elements = append(elements, "...")
+	}
+
+	for i := start; i < vm.sp; i++ {
+		elements = append(elements, compactInspect(vm.stack[i]))
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func compactInspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	s := []rune(strings.ReplaceAll(obj.Inspect(), "\n", "\\n"))
+
+	if len(s) > TRACEVALUEWIDTH {
+		return string(s[:TRACEVALUEWIDTH-3]) + "..."
+	}
+
+	return string(s)
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github/FabioVV/comp_lang/code"
 	"github/FabioVV/comp_lang/compiler"
+	"github/FabioVV/comp_lang/lib"
 	object "github/FabioVV/comp_lang/object"
 	token "github/FabioVV/comp_lang/token"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 const STACKSIZE int = 2048
@@ -18,6 +22,13 @@ var False = &object.Boolean{Value: false}
 // var Null = &object.Null{}
 var Null = &object.NULL
 
+// Closed by Cancel. cancelled is what the dispatch loop checks, done is for builtins that wait
+type cancellation struct {
+	cancelled atomic.Bool
+	done      chan struct{}
+	once      sync.Once
+}
+
 // The momo virtual machine. Hell yeah.
 type VM struct {
 	constants []object.Object
@@ -29,6 +40,15 @@ type VM struct {
 
 	sp int // stackpointer. Always points to the next value. Top of stack is stack[sp-1]
 
+	tracer   *Tracer   // nil unless tracing was asked for
+	profiler *Profiler // nil unless profiling was asked for
+	coverage *Coverage // nil unless line coverage was asked for
+
+	exit *ExitError // Set once exit was called, so the VM keeps unwinding even if a builtin swallowed the error
+
+	cancellation *cancellation // Shared with the VMs this one spawned, so cancelling it stops them too
+
+	denied map[string]bool // Capabilities builtins aren't allowed to use
 }
 
 func (v *VM) newVMError(format string, token token.Token, a ...interface{}) *object.Error {
@@ -56,7 +76,7 @@ func (vm *VM) popFrame() *Frame {
 
 func NewVM(bytecode *compiler.Bytecode) *VM {
 
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Name: "<main>", SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -70,6 +90,8 @@ func NewVM(bytecode *compiler.Bytecode) *VM {
 		frames:      frames,
 		framesIndex: 1,
 		sp:          0,
+
+		cancellation: &cancellation{done: make(chan struct{})},
 	}
 }
 
@@ -236,6 +258,36 @@ func (vm *VM) execIntComparison(op code.Opcode, left object.Object, right object
 	}
 }
 
+// Floats compare with floats and integers by value, the integer is turned into a float first
+func (vm *VM) execFltComparison(op code.Opcode, left object.Object, right object.Object) error {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObj(rightVal == leftVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObj(rightVal != leftVal))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObj(leftVal > rightVal))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+
+	}
+}
+
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
 func (vm *VM) execComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -244,46 +296,40 @@ func (vm *VM) execComparison(op code.Opcode) error {
 		return vm.execIntComparison(op, left, right)
 	}
 
+	// == compares what values hold, identical(a, b) is there for asking whether they're the same object
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObj(right == left))
+		return vm.push(nativeBoolToBooleanObj(object.Equal(left, right)))
 
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObj(right != left))
+		return vm.push(nativeBoolToBooleanObj(!object.Equal(left, right)))
+	}
 
-	default:
-		return fmt.Errorf("unknow operator -> %d (%s %s)", op, left.Type(), right.Type())
+	if isNumber(left) && isNumber(right) {
+		return vm.execFltComparison(op, left, right)
 	}
+
+	return fmt.Errorf("unknow operator -> %d (%s %s)", op, left.Type(), right.Type())
 }
 
+// Booleans made by builtins aren't True or False, so ! goes by truthiness rather than by which object it got
 func (vm *VM) execBangOperator() error {
 	operand := vm.pop()
 
-	switch operand {
-	case Null:
-		return vm.push(True)
-
-	case True:
-		return vm.push(False)
-
-	case False:
-		return vm.push(True)
-
-	default:
-		return vm.push(False)
-
-	}
+	return vm.push(nativeBoolToBooleanObj(!isTruthy(operand)))
 }
 
 func (vm *VM) execMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
 	}
 
-	val := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -val})
+	return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 
 }
 
@@ -311,84 +357,245 @@ func (vm *VM) buildArray(startIndex int, endIndex int) object.Object {
 	return &object.Array{Elements: elements}
 }
 
+// The pairs are on the stack in the order the literal was written, which is the order the hash keeps
 func (vm *VM) buildHash(startIndex int, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
-
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsKey(key)
 
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key : %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) execArrayIndex(left object.Object, index object.Object) error {
-	array := left.(*object.Array)
+	var elements []object.Object
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements = left.Elements
+	case *object.Tuple:
+		elements = left.Elements
+	}
+
 	i := index.(*object.Integer).Value
 
-	max := int64(len(array.Elements) - 1)
+	max := int64(len(elements) - 1)
 
 	if i < 0 || i > max {
 		return vm.push(Null)
 	}
 
-	return vm.push(array.Elements[i])
+	return vm.push(elements[i])
 }
 
 func (vm *VM) execHashIndex(left object.Object, index object.Object) error {
 	hash := left.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsKey(index)
 	if !ok {
 		return fmt.Errorf("unusable as hash key : %s", index.Type())
 	}
 
-	pair, ok := hash.Pairs[key.HashKey()]
+	value, ok := hash.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(pair.Value)
+	return vm.push(value)
 }
 
 func (vm *VM) execIndexExpression(left object.Object, index object.Object) error {
 	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ,
+		left.Type() == object.TUPLE_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.execArrayIndex(left, index)
 
 	case left.Type() == object.HASH_OBJ:
 		return vm.execHashIndex(left, index)
 
+	case left.Type() == object.SET_OBJ && index.Type() == object.STRING_OBJ:
+		method, ok := object.SetMethod(left.(*object.Set), index.(*object.String).Value)
+		if !ok {
+			return fmt.Errorf("sets have no method '%s'", index.(*object.String).Value)
+		}
+
+		return vm.push(method)
+
 	default:
 		return fmt.Errorf("index operator not supported : %s", left.Type())
 	}
 }
 
+/*
+x in s is whether the set s has x, x in h whether the hash h has the key x, x in a whether an element of the
+array or tuple a equals x and x in str whether x is part of the string str.
+*/
+func (vm *VM) execIn(element object.Object, collection object.Object) error {
+	switch collection := collection.(type) {
+	case *object.Set:
+		return vm.push(nativeBoolToBooleanObj(collection.Has(element)))
+
+	case *object.Hash:
+		key, ok := object.AsKey(element)
+		if !ok {
+			return vm.push(False)
+		}
+
+		_, ok = collection.Get(key)
+		return vm.push(nativeBoolToBooleanObj(ok))
+
+	case *object.Array:
+		return vm.push(nativeBoolToBooleanObj(hasElement(collection.Elements, element)))
+
+	case *object.Tuple:
+		return vm.push(nativeBoolToBooleanObj(hasElement(collection.Elements, element)))
+
+	case *object.String:
+		s, ok := element.(*object.String)
+		if !ok {
+			return fmt.Errorf("'in' a STRING needs a STRING, got %s", element.Type())
+		}
+
+		return vm.push(nativeBoolToBooleanObj(strings.Contains(collection.Value, s.Value)))
+	}
+
+	return fmt.Errorf("'in' not supported for %s", collection.Type())
+}
+
+func hasElement(elements []object.Object, element object.Object) bool {
+	for _, el := range elements {
+		// Checking identity first finds a nan that's in the array, even though it isn't equal to itself
+		if object.Identical(el, element) || object.Equal(el, element) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Turns on momo's virtual machine
 func (vm *VM) Run() error {
+	if vm.profiler != nil {
+		defer vm.profiler.stop()
+	}
+
+	return vm.run(0)
+}
+
+/*
+Cancel stops the VM from another goroutine. Run returns ErrCancelled before the next instruction, and builtins
+waiting on something, like sleep, stop waiting. Cancelling more than once is fine.
+*/
+func (vm *VM) Cancel() {
+	c := vm.cancellation
+
+	c.once.Do(func() {
+		c.cancelled.Store(true)
+		close(c.done)
+	})
+}
+
+// Done is closed once the VM is cancelled
+func (vm *VM) Done() <-chan struct{} {
+	return vm.cancellation.done
+}
+
+// Deny takes capabilities, like object.CAPABILITYPROC, away from the program. Everything is allowed by default
+func (vm *VM) Deny(capabilities ...string) {
+	if vm.denied == nil {
+		vm.denied = make(map[string]bool)
+	}
+
+	for _, c := range capabilities {
+		vm.denied[c] = true
+	}
+}
+
+func (vm *VM) Allows(capability string) bool {
+	return !vm.denied[capability]
+}
+
+/*
+Spawn makes a VM for calling the program's functions from another goroutine. It has its own stack and frames,
+and copies of the globals and of values (see object.Copy), so what it changes stays in it. It shares the
+constants, capabilities and cancellation, so it runs the same program and stops with it. Tracing, profiling
+and coverage stay with the VM that ran the program.
+
+Copying reads the globals, so nothing may be running on vm while it spawns.
+*/
+func (vm *VM) Spawn(values ...object.Object) (object.Host, []object.Object) {
+	frames := make([]*Frame, MAXFRAMES)
+	frames[0] = NewFrame(vm.frames[0].cl, 0)
+
+	copies := make(map[object.Object]object.Object)
+
+	globals := make([]object.Object, len(vm.globals))
+	for i, global := range vm.globals {
+		if global != nil {
+			globals[i] = object.Copy(global, copies)
+		}
+	}
+
+	copied := make([]object.Object, len(values))
+	for i, value := range values {
+		copied[i] = object.Copy(value, copies)
+	}
+
+	spawned := &VM{
+		constants:    vm.constants,
+		globals:      globals,
+		stack:        make([]object.Object, STACKSIZE),
+		frames:       frames,
+		framesIndex:  1,
+		cancellation: vm.cancellation,
+		denied:       vm.denied,
+	}
+
+	return spawned, copied
+}
+
+// The dispatch loop. It stops once the frame stack shrinks back to depth frames (or the
+// outermost frame runs out of instructions), which is how Call runs a single function to completion
+func (vm *VM) run(depth int) error {
 
 	//ip =  instruction pointer
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+
+		if vm.cancellation.cancelled.Load() {
+			return ErrCancelled
+		}
 
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip])
 
+		if vm.tracer != nil {
+			vm.tracer.trace(vm, ip, ins)
+		}
+
+		if vm.profiler != nil {
+			vm.profiler.step(vm, op)
+		}
+
+		if vm.coverage != nil {
+			vm.coverage.hit(vm.currentFrame().cl.Fn, ip)
+		}
+
 		switch op {
 		case code.OpConstant:
 			/*
@@ -418,6 +625,14 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpIn:
+			collection := vm.pop()
+			element := vm.pop()
+
+			if err := vm.execIn(element, collection); err != nil {
+				return err
+			}
+
 		case code.OpTrue:
 			if err := vm.push(True); err != nil {
 				return err
@@ -564,13 +779,33 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpLoadModule:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+
+			module, ok := lib.Load(name)
+			if !ok {
+				return fmt.Errorf("unknown library: %s", name)
+			}
+
+			if err := vm.push(module); err != nil {
+				return err
+			}
+
 		case code.OpGetBuiltin:
 			builtingIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
 			def := object.Builtins[builtingIndex]
 
-			if err := vm.push(def.Builtin); err != nil {
+			var builtin object.Object = def.Builtin
+			if def.Builtin.Value != nil {
+				builtin = def.Builtin.Value()
+			}
+
+			if err := vm.push(builtin); err != nil {
 				return err
 			}
 
@@ -628,9 +863,34 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result := builtin.Fn(args...)
+	var result object.Object
+
+	if builtin.HostFn != nil {
+		result = builtin.HostFn(vm, args...)
+	} else {
+		result = builtin.Fn(args...)
+	}
+
 	vm.sp = vm.sp - numArgs - 1
 
+	// exit was called from a function the builtin called back into
+	if vm.exit != nil {
+		return vm.exit
+	}
+
+	if failure, ok := result.(*object.AssertionFailure); ok {
+		return vm.newAssertionError(failure)
+	}
+
+	if exit, ok := result.(*object.Exit); ok {
+		vm.exit = &ExitError{Code: exit.Code}
+		return vm.exit
+	}
+
+	if halted, ok := result.(*object.Halted); ok {
+		return halted.Err
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -657,3 +917,42 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 
 	return vm.push(&object.Closure{Fn: function, Free: free})
 }
+
+/*
+Call runs fn (a closure or a builtin) with args to completion and returns what it returned.
+It's how Go code, and builtins that take callbacks, call momo functions. The call happens on top
+of whatever the VM is doing right now, so it can be used while the VM is in the middle of Run.
+If the call fails the stack and frames are put back the way they were.
+*/
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	base := vm.sp
+	depth := vm.framesIndex
+
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			vm.sp = base
+			return nil, err
+		}
+	}
+
+	err := vm.executeCall(len(args))
+
+	if err == nil {
+		err = vm.run(depth)
+	}
+
+	if err != nil {
+		vm.sp = base
+		vm.framesIndex = depth
+		return nil, err
+	}
+
+	result := vm.pop()
+	vm.sp = base
+
+	return result, nil
+}